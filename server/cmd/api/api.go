@@ -1,38 +1,78 @@
 package api
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 
+	"github.com/Brondont/E-Com-shop/config"
+	dbpkg "github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/handlers"
+	"github.com/Brondont/E-Com-shop/internal/jobs"
+	"github.com/Brondont/E-Com-shop/internal/notify"
+	"github.com/Brondont/E-Com-shop/internal/payments"
 	"github.com/Brondont/E-Com-shop/internal/routes"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
 
 type APIServer struct {
-	addr string
-	db   *sql.DB
+	addr     string
+	db       *sql.DB
+	notifier notify.Notifier
+	handler  *handlers.Handler
 }
 
-func NewAPIServer(addr string, db *sql.DB) *APIServer {
+// NewAPIServer builds the payment provider, notifier and handler once, every route and job shares them
+func NewAPIServer(addr string, db *sql.DB) (*APIServer, error) {
+	paymentProvider, err := payments.NewProvider(config.Envs.PaymentProvider, config.Envs.PaymentWebhookSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	notifier, err := notify.NewNotifierFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Envs.CarrierWebhookSecret == "" {
+		log.Printf("CarrierWebhookSecret isn't set, the carrier webhook is disabled")
+	}
+
 	return &APIServer{
-		addr: addr,
-		db:   db,
+		addr:     addr,
+		db:       db,
+		notifier: notifier,
+		handler:  handlers.NewHandler(paymentProvider, notifier),
+	}, nil
+}
+
+// StartJobs runs the background jobs that are turned on in the configuration
+func (s *APIServer) StartJobs(ctx context.Context) {
+	if config.Envs.CartReminderIdleAfter > 0 && config.Envs.CartReminderInterval > 0 {
+		jobs.NewCartReminderJob(dbpkg.DB.DB, s.notifier, config.Envs.CartReminderIdleAfter, config.Envs.CartReminderInterval, config.Envs.CartReminderMaxAttempts).Start(ctx)
+		log.Printf("Cart reminders enabled for carts idle for %s, checking every %s", config.Envs.CartReminderIdleAfter, config.Envs.CartReminderInterval)
+	}
+	if config.Envs.UnpaidOrderExpiresIn > 0 && config.Envs.UnpaidOrderInterval > 0 {
+		jobs.NewUnpaidOrderJob(s.handler, config.Envs.UnpaidOrderExpiresIn, config.Envs.UnpaidOrderInterval).Start(ctx)
+		log.Printf("Unpaid orders are cancelled after %s, checking every %s", config.Envs.UnpaidOrderExpiresIn, config.Envs.UnpaidOrderInterval)
 	}
 }
+
 func (s *APIServer) Run() error {
 	router := mux.NewRouter()
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
 
 	// set up routes
-	routes.SetupRoutes(subrouter)
+	routes.SetupRoutes(subrouter, s.handler)
 	routes.SetupStaticRoutes(router)
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Cart-Token"},
+		ExposedHeaders:   []string{"X-Cart-Token"},
 		AllowCredentials: true,
 		Debug:            true,
 	}).Handler(router)
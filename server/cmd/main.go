@@ -1,16 +1,34 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/Brondont/E-Com-shop/cmd/api"
+	"github.com/Brondont/E-Com-shop/config"
 	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/currency"
 )
 
 func main() {
 	db.ConnectDB()
 
-	server := api.NewAPIServer(":3080", nil)
+	if config.Envs.ExchangeRatesFile != "" {
+		imported, err := currency.ImportFile(db.DB.DB, config.Envs.ExchangeRatesFile)
+		if err != nil {
+			log.Printf("Failed to import exchange rates from %s: %v", config.Envs.ExchangeRatesFile, err)
+		} else {
+			log.Printf("Imported %d exchange rates from %s", imported, config.Envs.ExchangeRatesFile)
+		}
+	}
+
+	server, err := api.NewAPIServer(":3080", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.StartJobs(context.Background())
+
 	if err := server.Run(); err != nil {
 		log.Fatal(err)
 	}
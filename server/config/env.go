@@ -1,24 +1,94 @@
 package config
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	DBUser     string
 	DBPassword string
 	DBName     string
-  JWTSecret string
+	JWTSecret  string
+	// AccessTokenTTL is how long a login token is valid, RefreshTokenTTL how long it can be renewed for
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// PaymentProvider names the gateway orders are charged through, "fake" has to be picked explicitly
+	PaymentProvider string
+	// PaymentWebhookSecret signs the provider's webhooks, the server won't start without one
+	PaymentWebhookSecret string
+	// CarrierWebhookSecret signs the carriers' tracking webhooks, the webhook is off while it is empty
+	CarrierWebhookSecret string
+	// BaseCurrency is the ISO 4217 code catalog prices are stored and orders are charged in
+	BaseCurrency string
+	// ExchangeRatesFile is an optional CSV or JSON file of rates imported on startup
+	ExchangeRatesFile string
+	// TrustedProxies lists the addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For
+	// header is believed, requests from anywhere else are known by their own address
+	TrustedProxies []string
+	// ClientURL is where the storefront is served, links in emails point to it
+	ClientURL string
+	// PasswordResetTTL is how long a password reset link stays usable
+	PasswordResetTTL time.Duration
+	// EmailVerificationTTL is how long an email verification link stays usable
+	EmailVerificationTTL time.Duration
+	// RequireVerifiedEmail blocks checkout until the user has verified their email
+	RequireVerifiedEmail bool
+	// Notifier picks how customers are reached, "log" or "smtp"
+	Notifier     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	// CartReminderIdleAfter is how long a cart sits untouched before its owner is reminded, zero turns reminders off
+	CartReminderIdleAfter time.Duration
+	// CartReminderInterval is how often the reminder job looks for abandoned carts
+	CartReminderInterval time.Duration
+	// CartReminderMaxAttempts caps the failed sends retried for the same idle cart
+	CartReminderMaxAttempts int
+	// UnpaidOrderExpiresIn is how long an order may stay unpaid before it is cancelled, zero keeps them
+	UnpaidOrderExpiresIn time.Duration
+	// UnpaidOrderInterval is how often the job looks for unpaid orders
+	UnpaidOrderInterval time.Duration
 }
 
 var Envs = initConfig()
 
 func initConfig() Config {
 	return Config{
-		DBUser:     getEnv("DBUser", "kadi"),
-		DBPassword: getEnv("DBPassword", "kadi010203"),
-		DBName:     getEnv("DBName", "ecomdb"),
-    JWTSecret:   getEnv("JWTSecret", "jfeaiowjdiowfawijfdawo"),
+		DBUser:               getEnv("DBUser", "kadi"),
+		DBPassword:           getEnv("DBPassword", "kadi010203"),
+		DBName:               getEnv("DBName", "ecomdb"),
+		JWTSecret:            getEnv("JWTSecret", "jfeaiowjdiowfawijfdawo"),
+		AccessTokenTTL:       getEnvDuration("AccessTokenTTL", 15*time.Minute),
+		RefreshTokenTTL:      getEnvDuration("RefreshTokenTTL", 30*24*time.Hour),
+		PaymentProvider:      getEnv("PaymentProvider", ""),
+		PaymentWebhookSecret: getEnv("PaymentWebhookSecret", ""),
+		CarrierWebhookSecret: getEnv("CarrierWebhookSecret", ""),
+		BaseCurrency:         strings.ToUpper(getEnv("BaseCurrency", "USD")),
+		ExchangeRatesFile:    getEnv("ExchangeRatesFile", ""),
+		TrustedProxies:       getEnvList("TrustedProxies"),
+		ClientURL:            strings.TrimRight(getEnv("ClientURL", "http://localhost:3000"), "/"),
+		PasswordResetTTL:     getEnvDuration("PasswordResetTTL", time.Hour),
+		EmailVerificationTTL: getEnvDuration("EmailVerificationTTL", 48*time.Hour),
+		RequireVerifiedEmail: getEnvBool("RequireVerifiedEmail", false),
+		Notifier:             getEnv("Notifier", "log"),
+		SMTPHost:             getEnv("SMTPHost", "localhost"),
+		SMTPPort:             getEnv("SMTPPort", "1025"),
+		SMTPFrom:             getEnv("SMTPFrom", "shop@localhost"),
+		SMTPUsername:         getEnv("SMTPUsername", ""),
+		SMTPPassword:         getEnv("SMTPPassword", ""),
+
+		CartReminderIdleAfter:   getEnvDuration("CartReminderIdleAfter", 24*time.Hour),
+		CartReminderInterval:    getEnvDuration("CartReminderInterval", 15*time.Minute),
+		CartReminderMaxAttempts: getEnvInt("CartReminderMaxAttempts", 3),
+
+		UnpaidOrderExpiresIn: getEnvDuration("UnpaidOrderExpiresIn", time.Hour),
+		UnpaidOrderInterval:  getEnvDuration("UnpaidOrderInterval", 10*time.Minute),
 	}
 }
 
@@ -28,3 +98,56 @@ func getEnv(key string, fallback string) string {
 	}
 	return fallback
 }
+
+// getEnvList reads a comma separated list, blank entries are dropped
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvDuration reads a duration such as "24h" or "15m", a malformed value falls back with a warning
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using %s", value, key, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// getEnvInt reads a whole number, a malformed value falls back with a warning
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid number %q for %s, using %d", value, key, fallback)
+		return fallback
+	}
+	return number
+}
+
+// getEnvBool reads a flag such as "true" or "0", a malformed value falls back with a warning
+func getEnvBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid flag %q for %s, using %t", value, key, fallback)
+		return fallback
+	}
+	return flag
+}
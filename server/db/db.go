@@ -33,19 +33,50 @@ func ConnectDB() {
 	log.Println("Server connected to database")
 
 	log.Println("Running migrations")
+	if err := runMigrations(db); err != nil {
+		log.Fatal("Server failed to run migrations\n", err)
+	}
 	db.AutoMigrate(
+		&models.Permission{},
+		&models.Role{},
 		&models.User{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
 		&models.Category{},
 		&models.Brand{},
 		&models.Product{},
 		&models.Address{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusHistory{},
+		&models.Payment{},
+		&models.PaymentEvent{},
+		&models.Refund{},
+		&models.RefundItem{},
+		&models.ShippingMethod{},
+		&models.ShippingRate{},
+		&models.Shipment{},
+		&models.ShipmentEvent{},
+		&models.TaxRule{},
+		&models.Coupon{},
+		&models.CouponRedemption{},
+		&models.CartCoupon{},
+		&models.Promotion{},
+		&models.ExchangeRate{},
+		&models.GuestCart{},
+		&models.Wishlist{},
+		&models.WishlistItem{},
+		&models.CartReminder{},
 		&models.CartItem{},
 		&models.Inventory{},
 		&models.Variant{},
 		&models.Image{},
 	)
+	if err := backfillData(db); err != nil {
+		log.Fatal("Server failed to backfill data\n", err)
+	}
 	DB = DBInstance{
 		DB: db,
 	}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/models"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists the columns that held decimal amounts before money moved to minor units
+var moneyColumns = map[string][]string{
+	"variants":           {"price", "compare_at_price", "sale_price"},
+	"order_items":        {"price", "tax", "discount"},
+	"orders":             {"subtotal", "discount_total", "tax_total", "total", "shipping_cost"},
+	"payments":           {"amount", "amount_refunded"},
+	"refunds":            {"amount"},
+	"refund_items":       {"amount"},
+	"shipping_rates":     {"min_subtotal", "max_subtotal", "price"},
+	"coupons":            {"value", "min_subtotal"},
+	"coupon_redemptions": {"amount"},
+}
+
+// runMigrations applies the schema changes AutoMigrate can't express, it has to run before AutoMigrate
+func runMigrations(db *gorm.DB) error {
+	if err := migrateMoneyToMinorUnits(db); err != nil {
+		return err
+	}
+	if err := migrateCouponValues(db); err != nil {
+		return err
+	}
+	return migrateEmailVerification(db)
+}
+
+// migrateMoneyToMinorUnits converts decimal money columns to bigint cents, keeping existing values.
+// Columns that are already bigint or don't exist yet are skipped so it is safe to run on every start.
+func migrateMoneyToMinorUnits(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for table, columns := range moneyColumns {
+			for _, column := range columns {
+				var dataType string
+				result := tx.Raw(
+					"SELECT data_type FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA() AND table_name = ? AND column_name = ?",
+					table, column,
+				).Scan(&dataType)
+				if result.Error != nil {
+					return result.Error
+				}
+				if dataType != "numeric" {
+					continue
+				}
+
+				log.Printf("Converting %s.%s to minor units", table, column)
+				statement := fmt.Sprintf(
+					"ALTER TABLE %q ALTER COLUMN %q TYPE bigint USING ROUND(%q * 100)",
+					table, column, column,
+				)
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// migrateCouponValues splits the coupon value column, which held an amount or hundredths of a percent
+// depending on the type, into an amount column and a basis points column
+func migrateCouponValues(db *gorm.DB) error {
+	if !db.Migrator().HasTable("coupons") || !db.Migrator().HasColumn("coupons", "value") {
+		return nil
+	}
+
+	log.Println("Splitting coupon values into amounts and percentages")
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE coupons RENAME COLUMN value TO amount").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("ALTER TABLE coupons ADD COLUMN percent_basis_points bigint NOT NULL DEFAULT 0").Error; err != nil {
+			return err
+		}
+		return tx.Exec(
+			"UPDATE coupons SET percent_basis_points = CASE WHEN type = ? THEN amount ELSE 0 END, amount = CASE WHEN type = ? THEN amount ELSE 0 END",
+			models.CouponTypePercentage, models.CouponTypeFixed,
+		).Error
+	})
+}
+
+// migrateEmailVerification adds the email_verified_at column and counts users from before verification
+// existed as verified, so they aren't locked out. New users start unverified once the column exists.
+func migrateEmailVerification(db *gorm.DB) error {
+	if !db.Migrator().HasTable("users") || db.Migrator().HasColumn("users", "email_verified_at") {
+		return nil
+	}
+
+	log.Println("Adding email verification to users")
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("ALTER TABLE users ADD COLUMN email_verified_at timestamptz").Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE users SET email_verified_at = created_at").Error
+	})
+}
+
+// backfillData fills columns added to existing tables, it runs after AutoMigrate
+func backfillData(db *gorm.DB) error {
+	if err := backfillCurrencies(db); err != nil {
+		return err
+	}
+	if err := backfillCartPrices(db); err != nil {
+		return err
+	}
+	return seedRoles(db)
+}
+
+// backfillCurrencies stamps prices and orders from before currencies existed with the base currency
+func backfillCurrencies(db *gorm.DB) error {
+	for _, table := range []string{"variants", "orders"} {
+		statement := fmt.Sprintf("UPDATE %q SET currency = ? WHERE currency IS NULL OR currency = ''", table)
+		if err := db.Exec(statement, config.Envs.BaseCurrency).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillCartPrices gives cart lines from before price snapshots the variant's list price
+func backfillCartPrices(db *gorm.DB) error {
+	return db.Exec(
+		"UPDATE cart_items SET unit_price = variants.price FROM variants WHERE variants.id = cart_items.variant_id AND cart_items.unit_price = 0",
+	).Error
+}
+
+// seedRoles keeps the permission catalog and the built in roles in the database. The admin role is
+// reset to every permission on each start, the warehouse role is only created when it is missing.
+// Users flagged with the is_admin column from before roles existed are given the admin role and the column is dropped.
+func seedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		permissions := make([]models.Permission, 0, len(models.PermissionCatalog))
+		for _, entry := range models.PermissionCatalog {
+			permission := models.Permission{Name: entry.Name}
+			if err := tx.Where("name = ?", entry.Name).Attrs(entry).FirstOrCreate(&permission).Error; err != nil {
+				return err
+			}
+			if permission.Description != entry.Description {
+				if err := tx.Model(&permission).Update("description", entry.Description).Error; err != nil {
+					return err
+				}
+			}
+			permissions = append(permissions, permission)
+		}
+
+		adminRole := models.Role{Name: models.RoleAdmin}
+		if err := tx.Where("name = ?", models.RoleAdmin).Attrs(models.Role{Description: "Full access to the shop"}).FirstOrCreate(&adminRole).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&adminRole).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+
+		var warehouseRoles int64
+		if err := tx.Model(&models.Role{}).Where("name = ?", models.RoleWarehouse).Count(&warehouseRoles).Error; err != nil {
+			return err
+		}
+		if warehouseRoles == 0 {
+			warehouseRole := models.Role{Name: models.RoleWarehouse, Description: "Stock and order fulfilment"}
+			for _, permission := range permissions {
+				for _, name := range models.WarehousePermissions {
+					if permission.Name == name {
+						warehouseRole.Permissions = append(warehouseRole.Permissions, permission)
+					}
+				}
+			}
+			if err := tx.Create(&warehouseRole).Error; err != nil {
+				return err
+			}
+		}
+
+		if !tx.Migrator().HasColumn("users", "is_admin") {
+			return nil
+		}
+		log.Println("Moving admin users to the admin role")
+		result := tx.Exec(
+			"INSERT INTO user_roles (user_id, role_id) SELECT id, ? FROM users WHERE is_admin ON CONFLICT DO NOTHING",
+			adminRole.ID,
+		)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Migrator().DropColumn("users", "is_admin")
+	})
+}
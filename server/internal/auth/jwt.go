@@ -1,21 +1,71 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
 	"github.com/Brondont/E-Com-shop/config"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// CreateJWT Creates user login token
-func CreateJWT(userID uint, isAdmin bool) (string, error) {
+// AccessToken is a signed login token, ID is its jti claim
+type AccessToken struct {
+	Token     string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// CreateJWT Creates a short lived user login token
+func CreateJWT(userID uint) (*AccessToken, error) {
+	jwtID, err := RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(config.Envs.AccessTokenTTL)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": userID,
-		"isAdmin": isAdmin, 
+		"iat":    now.Unix(),
+		"exp":    expiresAt.Unix(),
+		"jti":    jwtID,
 	})
 
 	tokenString, err := token.SignedString([]byte(config.Envs.JWTSecret))
 	if err != nil {
+		return nil, err
+	}
+
+	return &AccessToken{
+		Token:     tokenString,
+		ID:        jwtID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// parseJWT checks the signature of a login token, tokens without an expiry are refused
+func parseJWT(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(config.Envs.JWTSecret), nil
+	}, jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+}
+
+// RandomToken returns size random bytes hex encoded
+func RandomToken(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
 		return "", err
 	}
+	return hex.EncodeToString(bytes), nil
+}
 
-	return tokenString, nil
+// HashToken returns the hash a secret token is stored under, so a leaked table can't be used to log in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
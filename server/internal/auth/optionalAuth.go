@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// OptionalAuth lets anonymous requests through untouched and validates the JWT token like IsAuth when one is sent.
+// Handlers behind it find the userID in the context only for logged in users.
+func OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		IsAuth(next).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+)
+
+// Require wraps an http.HandlerFunc and validates that the JWT token belongs to a user with the permission.
+// Permissions are read from the user's roles on every request so changes apply at once.
+func Require(permission string) func(http.HandlerFunc) http.HandlerFunc {
+	if !models.IsKnownPermission(permission) {
+		panic(fmt.Sprintf("auth.Require: unknown permission %q", permission))
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			session, claims, status, err := authenticate(r)
+			if err != nil {
+				utils.WriteError(w, status, err)
+				return
+			}
+
+			allowed, err := UserCan(session.UserID, permission)
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with checking permissions, try again"))
+				return
+			}
+			if !allowed {
+				utils.WriteError(w, http.StatusForbidden, fmt.Errorf("you need the %s permission to do this", permission))
+				return
+			}
+
+			// Create new context with userID and claims
+			ctx := context.WithValue(r.Context(), "userID", int(session.UserID))
+			ctx = context.WithValue(ctx, "sessionID", session.ID)
+			ctx = context.WithValue(ctx, "claims", claims)
+
+			// Create new request with updated context
+			extendedRequest := r.WithContext(ctx)
+
+			// Call the next handler with our extended request
+			next.ServeHTTP(w, extendedRequest)
+		}
+	}
+}
+
+// UserCan reports whether one of the user's roles grants the permission
+func UserCan(userID uint, permission string) (bool, error) {
+	var count int64
+	result := db.DB.DB.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.deleted_at IS NULL").
+		Where("user_roles.user_id = ? AND permissions.name = ?", userID, permission).
+		Count(&count)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
+// UserPermissions lists the distinct permissions granted by the user's roles
+func UserPermissions(userID uint) ([]string, error) {
+	var permissions []string
+	result := db.DB.DB.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id AND roles.deleted_at IS NULL").
+		Joins("JOIN role_permissions ON role_permissions.role_id = roles.id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.deleted_at IS NULL").
+		Where("user_roles.user_id = ?", userID).
+		Distinct().Pluck("permissions.name", &permissions)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return permissions, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrSessionRevoked = errors.New("session has ended, log in again")
+
+// authenticate validates the JWT token of a request and loads the session it belongs to along with its user.
+// On failure it returns the status to answer with.
+func authenticate(r *http.Request) (*models.Session, jwt.MapClaims, int, error) {
+	// Get token from Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, nil, http.StatusUnauthorized, errors.New("authorization header missing")
+	}
+
+	// Check if the header has the Bearer prefix
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return nil, nil, http.StatusUnauthorized, errors.New("invalid token format")
+	}
+
+	// Parse and validate the token
+	parsedToken, err := parseJWT(tokenParts[1])
+	if err != nil {
+		return nil, nil, http.StatusUnauthorized, err
+	}
+	if !parsedToken.Valid {
+		return nil, nil, http.StatusUnauthorized, errors.New("invalid token")
+	}
+
+	// Extract claims
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, nil, http.StatusUnauthorized, errors.New("unable to extract jwt token info")
+	}
+
+	userID, ok := claims["userID"].(float64)
+	if !ok {
+		return nil, nil, http.StatusUnauthorized, errors.New("invalid user ID in token")
+	}
+	jwtID, ok := claims["jti"].(string)
+	if !ok || jwtID == "" {
+		return nil, nil, http.StatusUnauthorized, errors.New("invalid token ID in token")
+	}
+
+	// The token is only as good as its session, a revoked session or a deleted user ends it
+	var session models.Session
+	result := db.DB.DB.Preload("User").
+		Where("token_id = ? AND user_id = ? AND revoked_at IS NULL", jwtID, uint(userID)).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, http.StatusUnauthorized, ErrSessionRevoked
+		}
+		return nil, nil, http.StatusInternalServerError, errors.New("something went wrong with checking the session, try again")
+	}
+	if session.User.ID == 0 {
+		return nil, nil, http.StatusUnauthorized, ErrSessionRevoked
+	}
+
+	return &session, claims, http.StatusOK, nil
+}
@@ -0,0 +1,160 @@
+package currency
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+var (
+	ErrInvalidCode   = errors.New("currency code has to be a three letter ISO 4217 code")
+	ErrInvalidRate   = errors.New("exchange rate has to be a positive number")
+	ErrUnknownFormat = errors.New("exchange rates can only be imported from csv or json")
+)
+
+// zeroDecimalCurrencies have no minor unit, converted amounts are rounded to whole units
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "ISK": true, "JPY": true, "KMF": true, "KRW": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// Normalize makes currency codes case and whitespace insensitive
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// IsValidCode reports whether code looks like an ISO 4217 code
+func IsValidCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Convert turns a base currency amount into code at rate, rounded half away from zero
+// to the smallest unit the target currency has
+func Convert(amount models.Money, rate float64, code string) models.Money {
+	converted := float64(amount) * rate
+	if zeroDecimalCurrencies[code] {
+		return models.Money(math.Round(converted/100) * 100)
+	}
+	return models.Money(math.Round(converted))
+}
+
+// ConvertPtr converts an optional amount
+func ConvertPtr(amount *models.Money, rate float64, code string) *models.Money {
+	if amount == nil {
+		return nil
+	}
+	converted := Convert(*amount, rate, code)
+	return &converted
+}
+
+// FormatFromFilename guesses the import format from the file extension
+func FormatFromFilename(filename string) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+}
+
+// ParseRates reads exchange rates from a csv file with currency,rate rows (a header row is allowed)
+// or from a json file holding either {"EUR": 0.92} or [{"currency": "EUR", "rate": 0.92}]
+func ParseRates(r io.Reader, format string) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+
+	switch format {
+	case "csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = 2
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		for i, record := range records {
+			if i == 0 && strings.EqualFold(strings.TrimSpace(record[0]), "currency") {
+				continue
+			}
+			rate, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, ErrInvalidRate)
+			}
+			rates = append(rates, models.ExchangeRate{Currency: record[0], Rate: rate})
+		}
+	case "json":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var byCode map[string]float64
+		if err := json.Unmarshal(data, &byCode); err == nil {
+			for code, rate := range byCode {
+				rates = append(rates, models.ExchangeRate{Currency: code, Rate: rate})
+			}
+		} else if err := json.Unmarshal(data, &rates); err != nil {
+			return nil, fmt.Errorf("decode json: %w", err)
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	for i := range rates {
+		rates[i].Currency = Normalize(rates[i].Currency)
+		if !IsValidCode(rates[i].Currency) {
+			return nil, fmt.Errorf("%q: %w", rates[i].Currency, ErrInvalidCode)
+		}
+		if rates[i].Rate <= 0 {
+			return nil, fmt.Errorf("%s: %w", rates[i].Currency, ErrInvalidRate)
+		}
+	}
+
+	return rates, nil
+}
+
+// SaveRates inserts new rates and updates existing ones, a previously deleted currency is brought back
+func SaveRates(tx *gorm.DB, rates []models.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"rate":       gorm.Expr("EXCLUDED.rate"),
+			"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+			"deleted_at": nil,
+		}),
+	}).Create(&rates).Error
+}
+
+// ImportFile loads the rates of a csv or json file into the database
+func ImportFile(tx *gorm.DB, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	rates, err := ParseRates(file, FormatFromFilename(path))
+	if err != nil {
+		return 0, err
+	}
+	if err := SaveRates(tx, rates); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
@@ -6,7 +6,9 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/Brondont/E-Com-shop/config"
 	"github.com/Brondont/E-Com-shop/db"
 	"github.com/Brondont/E-Com-shop/models"
 	"github.com/Brondont/E-Com-shop/utils"
@@ -23,9 +25,9 @@ type AdminHandler struct {
 	*Handler
 }
 
-func NewAdminHandler() *AdminHandler {
+func NewAdminHandler(handler *Handler) *AdminHandler {
 	return &AdminHandler{
-		Handler: NewHandler(),
+		Handler: handler,
 	}
 }
 
@@ -49,7 +51,7 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 
 	baseQuery := db.DB.DB.Model(&models.User{}).Select(
-		"id", "email", "username", "created_at", "phone_number", "is_admin",
+		"id", "email", "username", "created_at", "phone_number",
 	)
 
 	if search != "" {
@@ -67,11 +69,14 @@ func (h *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var users []models.User
-	result := baseQuery.Limit(limit).Offset(offset).Find(&users)
+	result := baseQuery.Preload("Roles").Limit(limit).Offset(offset).Find(&users)
 	if result.Error != nil {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("error fetching users"))
 		return
 	}
+	for i := range users {
+		users[i].IsAdmin = len(users[i].Roles) > 0
+	}
 
 	totalPages := int(math.Ceil(float64(total) / float64(limit)))
 
@@ -97,6 +102,11 @@ func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkCanManageTargetUser(r, userID); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
 	result := db.DB.DB.Where("id = ?", userID).Delete(&models.User{})
 	if result.Error != nil {
 		utils.WriteError(w, http.StatusInternalServerError, result.Error)
@@ -683,6 +693,68 @@ func (h *AdminHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 // Variant Management
 // ======================
 
+// parseVariantSale reads the optional sale fields of a variant form.
+// A missing field keeps the current value, an empty one clears it.
+func parseVariantSale(fields map[string][]string, variant *models.Variant) error {
+	parsePrice := func(key string) (*models.Money, bool, error) {
+		values, ok := fields[key]
+		if !ok || len(values) == 0 {
+			return nil, false, nil
+		}
+		if values[0] == "" {
+			return nil, true, nil
+		}
+		price, err := models.ParseMoney(values[0])
+		if err != nil || price < 0 {
+			return nil, true, fmt.Errorf("invalid %s", key)
+		}
+		return &price, true, nil
+	}
+	parseTime := func(key string) (*time.Time, bool, error) {
+		values, ok := fields[key]
+		if !ok || len(values) == 0 {
+			return nil, false, nil
+		}
+		if values[0] == "" {
+			return nil, true, nil
+		}
+		t, err := time.Parse(time.RFC3339, values[0])
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid %s, expected an RFC3339 date", key)
+		}
+		return &t, true, nil
+	}
+
+	if price, ok, err := parsePrice("compareAtPrice"); err != nil {
+		return err
+	} else if ok {
+		variant.CompareAtPrice = price
+	}
+	if price, ok, err := parsePrice("salePrice"); err != nil {
+		return err
+	} else if ok {
+		variant.SalePrice = price
+	}
+	if t, ok, err := parseTime("saleStartsAt"); err != nil {
+		return err
+	} else if ok {
+		variant.SaleStartsAt = t
+	}
+	if t, ok, err := parseTime("saleEndsAt"); err != nil {
+		return err
+	} else if ok {
+		variant.SaleEndsAt = t
+	}
+
+	if variant.SalePrice != nil && *variant.SalePrice >= variant.Price {
+		return errors.New("sale price has to be lower than the price")
+	}
+	if variant.SaleStartsAt != nil && variant.SaleEndsAt != nil && !variant.SaleEndsAt.After(*variant.SaleStartsAt) {
+		return errors.New("sale ends before it starts")
+	}
+	return nil
+}
+
 func (h *AdminHandler) PostVariant(w http.ResponseWriter, r *http.Request) {
 	_, ok := r.Context().Value("userID").(int)
 	if !ok {
@@ -710,13 +782,27 @@ func (h *AdminHandler) PostVariant(w http.ResponseWriter, r *http.Request) {
 	var variantPayload models.Variant
 	variantPayload.Name = formData.Fields["name"][0]
 	variantPayload.Description = formData.Fields["description"][0]
-	priceFloat64, err := strconv.ParseFloat(formData.Fields["price"][0], 64)
+	price, err := models.ParseMoney(formData.Fields["price"][0])
 	if err != nil {
 		tx.Rollback()
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-	variantPayload.Price = priceFloat64
+	variantPayload.Price = price
+	if weights := formData.Fields["weight"]; len(weights) > 0 && weights[0] != "" {
+		weight, err := strconv.ParseFloat(weights[0], 64)
+		if err != nil || weight < 0 {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid weight"))
+			return
+		}
+		variantPayload.Weight = weight
+	}
+	if err := parseVariantSale(formData.Fields, &variantPayload); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 	productIDInt, err := strconv.Atoi(formData.Fields["productID"][0])
 	if err != nil {
 		tx.Rollback()
@@ -724,6 +810,7 @@ func (h *AdminHandler) PostVariant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	variantPayload.ProductID = uint(productIDInt)
+	variantPayload.Currency = config.Envs.BaseCurrency
 
 	if formData.Model != nil {
 		modelPath, err := utils.SaveUploadedFile(formData.Model, modelUploadDirectory)
@@ -852,13 +939,27 @@ func (h *AdminHandler) PutVariant(w http.ResponseWriter, r *http.Request) {
 
 	oldVariant.Name = formData.Fields["name"][0]
 	oldVariant.Description = formData.Fields["description"][0]
-	priceFloat64, err := strconv.ParseFloat(formData.Fields["price"][0], 64)
+	price, err := models.ParseMoney(formData.Fields["price"][0])
 	if err != nil {
 		tx.Rollback()
 		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid price: %w", err))
 		return
 	}
-	oldVariant.Price = priceFloat64
+	oldVariant.Price = price
+	if weights := formData.Fields["weight"]; len(weights) > 0 && weights[0] != "" {
+		weight, err := strconv.ParseFloat(weights[0], 64)
+		if err != nil || weight < 0 {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid weight"))
+			return
+		}
+		oldVariant.Weight = weight
+	}
+	if err := parseVariantSale(formData.Fields, &oldVariant); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
 
 	quantity, err := strconv.Atoi(formData.Fields["quantity"][0])
 	if err != nil {
@@ -945,3 +1046,40 @@ func (h *AdminHandler) PutVariant(w http.ResponseWriter, r *http.Request) {
 		"variant": updatedVariant,
 	})
 }
+
+// PutVariantInventory sets the stock of a variant without touching the rest of it, for staff who only count stock
+func (h *AdminHandler) PutVariantInventory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	variantID := vars["variantID"]
+
+	var payload struct {
+		Quantity *int `json:"quantity"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.Quantity == nil || *payload.Quantity < 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("quantity must be zero or more"))
+		return
+	}
+
+	var inventory models.Inventory
+	result := db.DB.DB.Where("variant_id = ?", variantID).First(&inventory)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("variant not found: %w", result.Error))
+		return
+	}
+
+	inventory.Quantity = uint(*payload.Quantity)
+	result = db.DB.DB.Save(&inventory)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":   "Inventory updated successfully",
+		"inventory": inventory,
+	})
+}
@@ -0,0 +1,572 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// couponResult is what a valid coupon takes off a cart
+type couponResult struct {
+	Coupon       models.Coupon `json:"coupon"`
+	Discount     models.Money  `json:"discount"`
+	FreeShipping bool          `json:"freeShipping"`
+	// LineDiscounts holds the discount of every eligible line keyed by variant ID
+	LineDiscounts map[uint]models.Money `json:"lineDiscounts"`
+}
+
+// couponPayload is the admin representation of a coupon with its restrictions as IDs
+type couponPayload struct {
+	models.Coupon
+	CategoryIDs []uint `json:"categoryIDs"`
+	BrandIDs    []uint `json:"brandIDs"`
+	VariantIDs  []uint `json:"variantIDs"`
+}
+
+// normalizeCouponCode makes codes case and whitespace insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// findCoupon loads a coupon by code with its restrictions
+func findCoupon(tx *gorm.DB, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	result := tx.Preload("Categories").Preload("Brands").Preload("Variants").
+		Where("code = ?", normalizeCouponCode(code)).First(&coupon)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &coupon, nil
+}
+
+// couponAppliesTo reports whether a cart line is eligible for the coupon.
+// The variant's product has to be loaded for its category and brand.
+func couponAppliesTo(coupon models.Coupon, cartItem models.CartItem) bool {
+	if len(coupon.Categories) == 0 && len(coupon.Brands) == 0 && len(coupon.Variants) == 0 {
+		return true
+	}
+
+	for _, variant := range coupon.Variants {
+		if variant.ID == cartItem.VariantID {
+			return true
+		}
+	}
+	for _, category := range coupon.Categories {
+		if category.ID == cartItem.Variant.Product.CategoryID {
+			return true
+		}
+	}
+	for _, brand := range coupon.Brands {
+		if brand.ID == cartItem.Variant.Product.BrandID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// evaluateCoupon checks that the coupon can be used by the user on the cart and computes its discount.
+// priorDiscounts holds the discounts already granted per variant, the coupon applies to what is left.
+func evaluateCoupon(tx *gorm.DB, coupon models.Coupon, userID uint, cartItems []models.CartItem, priorDiscounts map[uint]models.Money) (*couponResult, error) {
+	now := time.Now()
+
+	if !coupon.Active {
+		return nil, errors.New("this coupon is not active")
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return nil, errors.New("this coupon is not valid yet")
+	}
+	if coupon.ExpiresAt != nil && now.After(*coupon.ExpiresAt) {
+		return nil, errors.New("this coupon has expired")
+	}
+	if coupon.UsageLimit > 0 && coupon.TimesUsed >= coupon.UsageLimit {
+		return nil, errors.New("this coupon has reached its usage limit")
+	}
+
+	if coupon.PerUserLimit > 0 {
+		var used int64
+		result := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ? AND user_id = ?", coupon.ID, userID).Count(&used)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if int(used) >= coupon.PerUserLimit {
+			return nil, errors.New("you already used this coupon the maximum number of times")
+		}
+	}
+
+	lineTotals := make(map[uint]models.Money)
+	var subtotal, eligibleTotal models.Money
+	var eligible []models.CartItem
+	for _, cartItem := range cartItems {
+		lineTotal := models.MaxMoney(cartItem.Variant.CurrentPrice.Mul(int(cartItem.Quantity))-priorDiscounts[cartItem.VariantID], 0)
+		lineTotals[cartItem.VariantID] = lineTotal
+		subtotal += lineTotal
+		if couponAppliesTo(coupon, cartItem) {
+			eligible = append(eligible, cartItem)
+			eligibleTotal += lineTotal
+		}
+	}
+	if subtotal < coupon.MinSubtotal {
+		return nil, fmt.Errorf("this coupon requires a subtotal of at least %s", coupon.MinSubtotal)
+	}
+	if len(eligible) == 0 {
+		return nil, errors.New("this coupon doesn't apply to any item in your cart")
+	}
+
+	couponResult := &couponResult{
+		Coupon:        coupon,
+		LineDiscounts: make(map[uint]models.Money),
+	}
+
+	switch coupon.Type {
+	case models.CouponTypeFreeShipping:
+		couponResult.FreeShipping = true
+	case models.CouponTypePercentage:
+		for _, cartItem := range eligible {
+			lineDiscount := lineTotals[cartItem.VariantID].BasisPoints(coupon.PercentBasisPoints)
+			couponResult.LineDiscounts[cartItem.VariantID] += lineDiscount
+			couponResult.Discount += lineDiscount
+		}
+	case models.CouponTypeFixed:
+		// Spread the amount over the eligible lines by weight, the last line takes the rounding leftover
+		discount := models.MinMoney(coupon.Amount, eligibleTotal)
+		remaining := discount
+		for i, cartItem := range eligible {
+			lineDiscount := remaining
+			if i < len(eligible)-1 {
+				lineDiscount = discount.Share(lineTotals[cartItem.VariantID], eligibleTotal)
+			}
+			couponResult.LineDiscounts[cartItem.VariantID] += lineDiscount
+			remaining -= lineDiscount
+		}
+		couponResult.Discount = discount
+	}
+	return couponResult, nil
+}
+
+// releaseCoupon gives a use back to the coupon of an order that is being cancelled
+func releaseCoupon(tx *gorm.DB, order models.Order) error {
+	if order.CouponID == nil {
+		return nil
+	}
+
+	result := tx.Where("order_id = ?", order.ID).Delete(&models.CouponRedemption{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return tx.Model(&models.Coupon{}).Where("id = ? AND times_used > 0", *order.CouponID).
+		Update("times_used", gorm.Expr("times_used - 1")).Error
+}
+
+// validateCoupon checks the fields of a coupon payload
+func validateCoupon(coupon models.Coupon) error {
+	if normalizeCouponCode(coupon.Code) == "" {
+		return errors.New("coupon code is required")
+	}
+	if !coupon.Type.IsValid() {
+		return errors.New("invalid coupon type")
+	}
+	if coupon.Type == models.CouponTypePercentage && (coupon.PercentBasisPoints <= 0 || coupon.PercentBasisPoints > 10000) {
+		return errors.New("percentage coupons need between 1 and 10000 basis points")
+	}
+	if coupon.Type != models.CouponTypePercentage && coupon.PercentBasisPoints != 0 {
+		return errors.New("only percentage coupons take basis points")
+	}
+	if coupon.Type == models.CouponTypeFixed && coupon.Amount <= 0 {
+		return errors.New("fixed amount coupons need a positive amount")
+	}
+	if coupon.Type != models.CouponTypeFixed && coupon.Amount != 0 {
+		return errors.New("only fixed amount coupons take an amount")
+	}
+	if coupon.MinSubtotal < 0 || coupon.UsageLimit < 0 || coupon.PerUserLimit < 0 {
+		return errors.New("minimum subtotal and usage limits can't be negative")
+	}
+	if coupon.StartsAt != nil && coupon.ExpiresAt != nil && coupon.ExpiresAt.Before(*coupon.StartsAt) {
+		return errors.New("coupon expires before it starts")
+	}
+	return nil
+}
+
+// replaceCouponRestrictions sets the categories, brands and variants a coupon is restricted to
+func replaceCouponRestrictions(tx *gorm.DB, coupon *models.Coupon, payload couponPayload) error {
+	var categories []models.Category
+	if len(payload.CategoryIDs) > 0 {
+		if err := tx.Where("id IN ?", payload.CategoryIDs).Find(&categories).Error; err != nil {
+			return err
+		}
+	}
+	var brands []models.Brand
+	if len(payload.BrandIDs) > 0 {
+		if err := tx.Where("id IN ?", payload.BrandIDs).Find(&brands).Error; err != nil {
+			return err
+		}
+	}
+	var variants []models.Variant
+	if len(payload.VariantIDs) > 0 {
+		if err := tx.Where("id IN ?", payload.VariantIDs).Find(&variants).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(coupon).Association("Categories").Replace(categories); err != nil {
+		return err
+	}
+	if err := tx.Model(coupon).Association("Brands").Replace(brands); err != nil {
+		return err
+	}
+	return tx.Model(coupon).Association("Variants").Replace(variants)
+}
+
+// PostCartCoupon applies a coupon code to the user's cart
+func (h *UserHandler) PostCartCoupon(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	coupon, err := findCoupon(db.DB.DB, payload.Code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("coupon not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with applying the coupon, try again"))
+		return
+	}
+
+	var cartItems []models.CartItem
+	result := db.DB.DB.Preload("Variant").Preload("Variant.Product").Where("user_id = ?", userID).Find(&cartItems)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with applying the coupon, try again"))
+		return
+	}
+
+	promotions, err := loadActivePromotions(db.DB.DB)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with applying the coupon, try again"))
+		return
+	}
+
+	discount, err := evaluateCoupon(db.DB.DB, *coupon, uint(userID), cartItems, applyPromotions(promotions, cartItems).LineDiscounts)
+	if err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// A cart holds a single coupon, applying a new one replaces the previous
+	result = tx.Unscoped().Where("user_id = ?", userID).Delete(&models.CartCoupon{})
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with applying the coupon, try again"))
+		return
+	}
+
+	result = tx.Create(&models.CartCoupon{
+		UserID:   uint(userID),
+		CouponID: coupon.ID,
+	})
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with applying the coupon, try again"))
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Coupon applied",
+		"discount": discount,
+	})
+}
+
+// DeleteCartCoupon removes the coupon applied to the user's cart
+func (h *UserHandler) DeleteCartCoupon(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	result := db.DB.DB.Unscoped().Where("user_id = ?", userID).Delete(&models.CartCoupon{})
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with removing the coupon, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Coupon removed",
+	})
+}
+
+// ======================
+// Coupon Management
+// ======================
+
+func (h *AdminHandler) GetCoupons(w http.ResponseWriter, r *http.Request) {
+	var coupons []models.Coupon
+	result := db.DB.DB.Preload("Categories").Preload("Brands").Preload("Variants").Order("created_at DESC").Find(&coupons)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting coupons, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Successfully fetched results",
+		"coupons": coupons,
+	})
+}
+
+func (h *AdminHandler) PostCoupon(w http.ResponseWriter, r *http.Request) {
+	var payload couponPayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateCoupon(payload.Coupon); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	coupon := payload.Coupon
+	coupon.ID = 0
+	coupon.Code = normalizeCouponCode(coupon.Code)
+	coupon.TimesUsed = 0
+	coupon.Categories = nil
+	coupon.Brands = nil
+	coupon.Variants = nil
+
+	var existing int64
+	// Deleted coupons keep their code, the orders that used it still show it
+	db.DB.DB.Unscoped().Model(&models.Coupon{}).Where("code = ?", coupon.Code).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, errors.New("a coupon with this code already exists or was deleted"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result := tx.Create(&coupon)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	if err := replaceCouponRestrictions(tx, &coupon, payload); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	createdCoupon, err := findCoupon(db.DB.DB, coupon.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message": "Coupon created successfully",
+		"coupon":  createdCoupon,
+	})
+}
+
+func (h *AdminHandler) PutCoupon(w http.ResponseWriter, r *http.Request) {
+	var payload couponPayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("coupon ID is required"))
+		return
+	}
+
+	if err := validateCoupon(payload.Coupon); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var coupon models.Coupon
+	result := tx.First(&coupon, payload.ID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("coupon not found: %w", result.Error))
+		return
+	}
+
+	code := normalizeCouponCode(payload.Code)
+	if code != coupon.Code {
+		var existing int64
+		tx.Unscoped().Model(&models.Coupon{}).Where("code = ? AND id <> ?", code, coupon.ID).Count(&existing)
+		if existing > 0 {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusConflict, errors.New("a coupon with this code already exists or was deleted"))
+			return
+		}
+	}
+
+	coupon.Code = code
+	coupon.Description = payload.Description
+	coupon.Type = payload.Type
+	coupon.Amount = payload.Amount
+	coupon.PercentBasisPoints = payload.PercentBasisPoints
+	coupon.MinSubtotal = payload.MinSubtotal
+	coupon.StartsAt = payload.StartsAt
+	coupon.ExpiresAt = payload.ExpiresAt
+	coupon.UsageLimit = payload.UsageLimit
+	coupon.PerUserLimit = payload.PerUserLimit
+	coupon.Active = payload.Active
+
+	result = tx.Omit("Categories", "Brands", "Variants").Save(&coupon)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	if err := replaceCouponRestrictions(tx, &coupon, payload); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	updatedCoupon, err := findCoupon(db.DB.DB, coupon.Code)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Coupon updated successfully",
+		"coupon":  updatedCoupon,
+	})
+}
+
+func (h *AdminHandler) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	couponID := vars["couponID"]
+
+	if couponID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("coupon id is missing in the url"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var coupon models.Coupon
+	result := tx.First(&coupon, couponID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("coupon not found: %w", result.Error))
+		return
+	}
+
+	// Carts can't keep a coupon that is gone, orders and redemptions keep pointing at it
+	result = tx.Unscoped().Where("coupon_id = ?", coupon.ID).Delete(&models.CartCoupon{})
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	// The coupon is deactivated and soft deleted so the orders that used it keep their history
+	result = tx.Model(&coupon).Update("active", false)
+	if result.Error == nil {
+		result = tx.Delete(&coupon)
+	}
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Coupon was deleted.",
+	})
+}
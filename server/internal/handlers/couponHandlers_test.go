@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+func TestValidateCouponValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		coupon  models.Coupon
+		wantErr bool
+	}{
+		{"percentage in basis points", models.Coupon{Code: "TEN", Type: models.CouponTypePercentage, PercentBasisPoints: 1000}, false},
+		{"whole order for free", models.Coupon{Code: "ALL", Type: models.CouponTypePercentage, PercentBasisPoints: 10000}, false},
+		{"percentage above 100%", models.Coupon{Code: "MORE", Type: models.CouponTypePercentage, PercentBasisPoints: 10001}, true},
+		{"percentage without points", models.Coupon{Code: "NONE", Type: models.CouponTypePercentage}, true},
+		{"percentage with an amount", models.Coupon{Code: "MIX", Type: models.CouponTypePercentage, PercentBasisPoints: 1000, Amount: 500}, true},
+		{"fixed amount", models.Coupon{Code: "FIVE", Type: models.CouponTypeFixed, Amount: 500}, false},
+		{"fixed without amount", models.Coupon{Code: "ZERO", Type: models.CouponTypeFixed}, true},
+		{"fixed with points", models.Coupon{Code: "MIX", Type: models.CouponTypeFixed, Amount: 500, PercentBasisPoints: 1000}, true},
+		{"free shipping", models.Coupon{Code: "SHIP", Type: models.CouponTypeFreeShipping}, false},
+		{"free shipping with an amount", models.Coupon{Code: "SHIP", Type: models.CouponTypeFreeShipping, Amount: 500}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoupon(tt.coupon)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateCoupon() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
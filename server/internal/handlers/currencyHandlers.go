@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/currency"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+var errUnsupportedCurrency = errors.New("unsupported currency")
+
+// displayCurrency is the currency prices are shown in and how much of it one base unit buys
+type displayCurrency struct {
+	Code string
+	Rate float64
+}
+
+// requestCurrency reads the currency query parameter, prices stay in the base currency when it is missing
+func requestCurrency(r *http.Request) (displayCurrency, error) {
+	code := currency.Normalize(r.URL.Query().Get("currency"))
+	if code == "" || code == config.Envs.BaseCurrency {
+		return displayCurrency{Code: config.Envs.BaseCurrency, Rate: 1}, nil
+	}
+	if !currency.IsValidCode(code) {
+		return displayCurrency{}, errUnsupportedCurrency
+	}
+
+	var exchangeRate models.ExchangeRate
+	result := db.DB.DB.Where("currency = ?", code).First(&exchangeRate)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return displayCurrency{}, errUnsupportedCurrency
+		}
+		return displayCurrency{}, result.Error
+	}
+
+	return displayCurrency{Code: code, Rate: exchangeRate.Rate}, nil
+}
+
+// writeCurrencyError answers a failed requestCurrency call
+func writeCurrencyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnsupportedCurrency) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("%w, use a currency with an exchange rate", err))
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with converting prices, try again"))
+}
+
+func (c displayCurrency) convert(amount models.Money) models.Money {
+	if c.Code == config.Envs.BaseCurrency {
+		return amount
+	}
+	return currency.Convert(amount, c.Rate, c.Code)
+}
+
+// convertVariant rewrites the prices of a variant in the display currency
+func (c displayCurrency) convertVariant(variant *models.Variant) {
+	if c.Code == config.Envs.BaseCurrency {
+		return
+	}
+	variant.Price = c.convert(variant.Price)
+	variant.CurrentPrice = c.convert(variant.CurrentPrice)
+	variant.CompareAtPrice = currency.ConvertPtr(variant.CompareAtPrice, c.Rate, c.Code)
+	variant.SalePrice = currency.ConvertPtr(variant.SalePrice, c.Rate, c.Code)
+	variant.Currency = c.Code
+}
+
+// convertPromotions rewrites the discounts of a promotion result in the display currency.
+// Lines are converted one by one and the totals summed back so they always add up.
+func (c displayCurrency) convertPromotions(promotions *promotionResult) {
+	if c.Code == config.Envs.BaseCurrency {
+		return
+	}
+	for variantID, discount := range promotions.LineDiscounts {
+		promotions.LineDiscounts[variantID] = c.convert(discount)
+	}
+	promotions.Discount = 0
+	for i := range promotions.Applied {
+		promotions.Applied[i].Discount = c.convert(promotions.Applied[i].Discount)
+		promotions.Discount += promotions.Applied[i].Discount
+	}
+}
+
+// convertPricing rewrites a cart summary in the display currency, totals are summed back from the converted lines
+func (c displayCurrency) convertPricing(pricing *cartPricing) {
+	if c.Code == config.Envs.BaseCurrency {
+		return
+	}
+
+	c.convertPromotions(&pricing.Promotions)
+	if pricing.Coupon != nil {
+		pricing.Coupon.Discount = 0
+		for variantID, discount := range pricing.Coupon.LineDiscounts {
+			pricing.Coupon.LineDiscounts[variantID] = c.convert(discount)
+			pricing.Coupon.Discount += pricing.Coupon.LineDiscounts[variantID]
+		}
+		c.convertCoupon(&pricing.Coupon.Coupon)
+	}
+	if pricing.ShippingMethod != nil {
+		pricing.ShippingMethod = c.convertShippingMethod(*pricing.ShippingMethod)
+	}
+
+	pricing.Subtotal, pricing.DiscountTotal, pricing.TaxTotal = 0, 0, 0
+	for i := range pricing.Lines {
+		line := &pricing.Lines[i]
+		line.UnitPrice = c.convert(line.UnitPrice)
+		line.LineTotal = c.convert(line.LineTotal)
+		line.Discount = c.convert(line.Discount)
+		line.Tax = c.convert(line.Tax)
+		line.Total = line.LineTotal - line.Discount + line.Tax
+		line.PreviousUnitPrice = currency.ConvertPtr(line.PreviousUnitPrice, c.Rate, c.Code)
+
+		pricing.Subtotal += line.LineTotal
+		pricing.DiscountTotal += line.Discount
+		pricing.TaxTotal += line.Tax
+	}
+	for i := range pricing.TaxBreakdown {
+		line := &pricing.TaxBreakdown[i]
+		line.LineTotal = c.convert(line.LineTotal)
+		line.Discount = c.convert(line.Discount)
+		line.Tax = c.convert(line.Tax)
+	}
+	pricing.ShippingCost = c.convert(pricing.ShippingCost)
+	pricing.Total = pricing.Subtotal - pricing.DiscountTotal + pricing.TaxTotal + pricing.ShippingCost
+}
+
+// convertCoupon rewrites the amounts of a coupon in the display currency. The percentage stays as it is.
+func (c displayCurrency) convertCoupon(coupon *models.Coupon) {
+	coupon.Amount = c.convert(coupon.Amount)
+	coupon.MinSubtotal = c.convert(coupon.MinSubtotal)
+
+	// The variants are copied so the caller's slice keeps its prices
+	variants := make([]models.Variant, len(coupon.Variants))
+	copy(variants, coupon.Variants)
+	for i := range variants {
+		c.convertVariant(&variants[i])
+	}
+	coupon.Variants = variants
+}
+
+// convertShippingMethod returns a copy of the shipping method with its rates in the display currency
+func (c displayCurrency) convertShippingMethod(shippingMethod models.ShippingMethod) *models.ShippingMethod {
+	rates := make([]models.ShippingRate, len(shippingMethod.Rates))
+	for i, rate := range shippingMethod.Rates {
+		rate.Price = c.convert(rate.Price)
+		rate.MinSubtotal = c.convert(rate.MinSubtotal)
+		rate.MaxSubtotal = c.convert(rate.MaxSubtotal)
+		rates[i] = rate
+	}
+	shippingMethod.Rates = rates
+	return &shippingMethod
+}
+
+// validateExchangeRate checks the fields of an exchange rate payload
+func validateExchangeRate(exchangeRate models.ExchangeRate) error {
+	if !currency.IsValidCode(exchangeRate.Currency) {
+		return currency.ErrInvalidCode
+	}
+	if exchangeRate.Currency == config.Envs.BaseCurrency {
+		return errors.New("the base currency doesn't need an exchange rate")
+	}
+	if exchangeRate.Rate <= 0 {
+		return currency.ErrInvalidRate
+	}
+	return nil
+}
+
+// ======================
+// Exchange Rate Management
+// ======================
+
+func (h *AdminHandler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	var exchangeRates []models.ExchangeRate
+	result := db.DB.DB.Order("currency ASC").Find(&exchangeRates)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting exchange rates, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":       "Successfully fetched results",
+		"baseCurrency":  config.Envs.BaseCurrency,
+		"exchangeRates": exchangeRates,
+	})
+}
+
+func (h *AdminHandler) PostExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var exchangeRate models.ExchangeRate
+	if err := utils.ParseJson(r, &exchangeRate); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	exchangeRate.ID = 0
+	exchangeRate.Currency = currency.Normalize(exchangeRate.Currency)
+	if err := validateExchangeRate(exchangeRate); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	var existing int64
+	db.DB.DB.Model(&models.ExchangeRate{}).Where("currency = ?", exchangeRate.Currency).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, errors.New("an exchange rate for this currency already exists"))
+		return
+	}
+
+	if err := currency.SaveRates(db.DB.DB, []models.ExchangeRate{exchangeRate}); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	db.DB.DB.Where("currency = ?", exchangeRate.Currency).First(&exchangeRate)
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":      "Exchange rate created successfully",
+		"exchangeRate": exchangeRate,
+	})
+}
+
+func (h *AdminHandler) PutExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var payload models.ExchangeRate
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("exchange rate ID is required"))
+		return
+	}
+
+	var exchangeRate models.ExchangeRate
+	result := db.DB.DB.First(&exchangeRate, payload.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("exchange rate not found: %w", result.Error))
+		return
+	}
+
+	// The currency identifies the rate, only the rate itself can change
+	exchangeRate.Rate = payload.Rate
+	if err := validateExchangeRate(exchangeRate); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	result = db.DB.DB.Save(&exchangeRate)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":      "Exchange rate updated successfully",
+		"exchangeRate": exchangeRate,
+	})
+}
+
+func (h *AdminHandler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	exchangeRateID := vars["exchangeRateID"]
+
+	if exchangeRateID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("exchange rate id is missing in the url"))
+		return
+	}
+
+	result := db.DB.DB.Delete(&models.ExchangeRate{}, exchangeRateID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, errors.New("exchange rate not found"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Exchange rate was deleted.",
+	})
+}
+
+// PostExchangeRatesImport loads rates from an uploaded csv or json file sent as the "file" form field
+func (h *AdminHandler) PostExchangeRatesImport(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxFileSize); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("parse multipart form: %w", err))
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("an exchange rates file is required"))
+		return
+	}
+	defer file.Close()
+
+	rates, err := currency.ParseRates(file, currency.FormatFromFilename(fileHeader.Filename))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, rate := range rates {
+		if rate.Currency == config.Envs.BaseCurrency {
+			utils.WriteError(w, http.StatusConflict, errors.New("the base currency doesn't need an exchange rate"))
+			return
+		}
+	}
+
+	if err := currency.SaveRates(db.DB.DB, rates); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with importing exchange rates, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Exchange rates imported successfully",
+		"imported": len(rates),
+	})
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+func TestConvertPricingConvertsEveryAmount(t *testing.T) {
+	shippingMethod := &models.ShippingMethod{
+		Rates: []models.ShippingRate{{Price: 1000, MinSubtotal: 2000, MaxSubtotal: 10000}},
+	}
+	coupon := &couponResult{
+		Coupon: models.Coupon{
+			Amount:      500,
+			MinSubtotal: 4000,
+			Variants:    []models.Variant{{Price: 3000, CurrentPrice: 3000}},
+		},
+		LineDiscounts: map[uint]models.Money{},
+	}
+	pricing := &cartPricing{Coupon: coupon, ShippingMethod: shippingMethod}
+
+	eur := displayCurrency{Code: "EUR", Rate: 0.5}
+	eur.convertPricing(pricing)
+
+	rate := pricing.ShippingMethod.Rates[0]
+	if rate.Price != 500 || rate.MinSubtotal != 1000 || rate.MaxSubtotal != 5000 {
+		t.Errorf("shipping rate = %+v, want its amounts halved", rate)
+	}
+	if pricing.Coupon.Coupon.Amount != 250 || pricing.Coupon.Coupon.MinSubtotal != 2000 {
+		t.Errorf("coupon amount = %s, min subtotal = %s, want 250 and 2000", pricing.Coupon.Coupon.Amount, pricing.Coupon.Coupon.MinSubtotal)
+	}
+	if variant := pricing.Coupon.Coupon.Variants[0]; variant.Price != 1500 || variant.Currency != "EUR" {
+		t.Errorf("coupon variant = %s %s, want 1500 EUR", variant.Price, variant.Currency)
+	}
+
+	// The loaded records stay in the base currency
+	if shippingMethod.Rates[0].Price != 1000 {
+		t.Errorf("original shipping rate was changed to %s", shippingMethod.Rates[0].Price)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/auth"
+	"github.com/Brondont/E-Com-shop/internal/notify"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+)
+
+// verificationResendInterval is how long a user waits before asking for another verification email
+const verificationResendInterval = time.Minute
+
+var (
+	errEmailVerificationInvalid = errors.New("the verification link is invalid or expired")
+	errEmailNotVerified         = errors.New("verify your email before checking out")
+)
+
+// createEmailVerificationToken replaces the user's pending verification tokens with a new one and returns the raw token
+func createEmailVerificationToken(tx *gorm.DB, userID uint) (string, error) {
+	rawToken, err := auth.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the latest link works, older ones are spent
+	result := tx.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	verificationToken := models.EmailVerificationToken{
+		UserID:    userID,
+		TokenHash: auth.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(config.Envs.EmailVerificationTTL),
+	}
+	if result := tx.Create(&verificationToken); result.Error != nil {
+		return "", result.Error
+	}
+
+	return rawToken, nil
+}
+
+// sendEmailVerification mails the user a new verification link. Only creating the token can fail,
+// the email goes out in the background.
+func (h *Handler) sendEmailVerification(user models.User) error {
+	rawToken, err := createEmailVerificationToken(db.DB.DB, user.ID)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.Envs.ClientURL, url.QueryEscape(rawToken))
+	h.sendMail(notify.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nConfirm this is your email address by opening this link:\n%s\n\nThe link expires in %s.",
+			user.Username, link, config.Envs.EmailVerificationTTL,
+		),
+	})
+	return nil
+}
+
+// requireVerifiedEmail reports errEmailNotVerified when checkout is limited to verified users and the user isn't one
+func requireVerifiedEmail(tx *gorm.DB, userID uint) error {
+	if !config.Envs.RequireVerifiedEmail {
+		return nil
+	}
+
+	var user models.User
+	if result := tx.Select("id", "email_verified_at").First(&user, userID); result.Error != nil {
+		return result.Error
+	}
+	if user.EmailVerifiedAt == nil {
+		return errEmailNotVerified
+	}
+	return nil
+}
+
+// GetVerifyEmail confirms the email of the user a verification token was sent to
+func (h *UserHandler) GetVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	rawToken := r.URL.Query().Get("token")
+	if rawToken == "" {
+		utils.WriteError(w, http.StatusBadRequest, errEmailVerificationInvalid)
+		return
+	}
+
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var verificationToken models.EmailVerificationToken
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", auth.HashToken(rawToken)).First(&verificationToken)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return errEmailVerificationInvalid
+			}
+			return result.Error
+		}
+		if verificationToken.UsedAt != nil || time.Now().After(verificationToken.ExpiresAt) {
+			return errEmailVerificationInvalid
+		}
+
+		now := time.Now()
+		if err := tx.Model(&verificationToken).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		result = tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", verificationToken.UserID).
+			Update("email_verified_at", now)
+		return result.Error
+	})
+	if err != nil {
+		if errors.Is(err, errEmailVerificationInvalid) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with verifying the email, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Email verified",
+	})
+}
+
+// PostResendVerification mails a new verification link to the logged in user
+func (h *UserHandler) PostResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var user models.User
+	result := db.DB.DB.First(&user, userID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		utils.WriteError(w, http.StatusConflict, errors.New("your email is already verified"))
+		return
+	}
+
+	var recent int64
+	result = db.DB.DB.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-verificationResendInterval)).
+		Count(&recent)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with sending the verification email, try again"))
+		return
+	}
+	if recent > 0 {
+		utils.WriteError(w, http.StatusTooManyRequests, errors.New("a verification email was just sent, wait a minute before asking again"))
+		return
+	}
+
+	if err := h.sendEmailVerification(user); err != nil {
+		log.Printf("failed to create an email verification token for user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with sending the verification email, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Verification email sent",
+	})
+}
@@ -17,9 +17,9 @@ type GeneralHandler struct {
 	*Handler
 }
 
-func NewGeneralHandler() *GeneralHandler {
+func NewGeneralHandler(handler *Handler) *GeneralHandler {
 	return &GeneralHandler{
-		Handler: NewHandler(),
+		Handler: handler,
 	}
 }
 
@@ -83,6 +83,12 @@ func (h *GeneralHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	productID := vars["productID"] // Get the productID from the URL
 
+	displayCurrency, err := requestCurrency(r)
+	if err != nil {
+		writeCurrencyError(w, err)
+		return
+	}
+
 	var productPayload models.Product
 	result := db.DB.DB.Preload("Variants").Preload("Variants.Images").Preload("Variants.Inventory").Preload("Image").Where("ID = ?", productID).Find(&productPayload)
 	if result.Error != nil {
@@ -90,9 +96,32 @@ func (h *GeneralHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var variantIDs []uint
+	for _, variant := range productPayload.Variants {
+		variantIDs = append(variantIDs, variant.ID)
+	}
+
+	// Running promotions that include one of the product's variants
+	promotions, err := loadVariantPromotions(db.DB.DB, variantIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with fetching products, try again"))
+		return
+	}
+
+	for i := range productPayload.Variants {
+		displayCurrency.convertVariant(&productPayload.Variants[i])
+	}
+	for i := range promotions {
+		for j := range promotions[i].Variants {
+			displayCurrency.convertVariant(&promotions[i].Variants[j])
+		}
+	}
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
-		"message": "Fetched product",
-		"product": productPayload,
+		"message":    "Fetched product",
+		"product":    productPayload,
+		"promotions": promotions,
+		"currency":   displayCurrency.Code,
 	})
 }
 
@@ -101,6 +130,12 @@ func (h *GeneralHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	search := r.URL.Query().Get("search")
 
+	displayCurrency, err := requestCurrency(r)
+	if err != nil {
+		writeCurrencyError(w, err)
+		return
+	}
+
 	// Default values for pagination
 	if page < 1 {
 		page = 1
@@ -116,7 +151,7 @@ func (h *GeneralHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 	// Initialize the base query
 
-	baseQuery := db.DB.DB.Model(&models.Product{}).Preload("Image").Preload("Category").Preload("Brand")
+	baseQuery := db.DB.DB.Model(&models.Product{}).Preload("Image").Preload("Category").Preload("Brand").Preload("Variants")
 
 	// Apply search filter if provided
 	if search != "" {
@@ -174,6 +209,31 @@ func (h *GeneralHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var variantIDs []uint
+	for _, product := range products {
+		for _, variant := range product.Variants {
+			variantIDs = append(variantIDs, variant.ID)
+		}
+	}
+
+	// Running promotions of the listed products, keyed by product ID
+	promotions, err := loadVariantPromotions(db.DB.DB, variantIDs)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting products, try again"))
+		return
+	}
+
+	for i := range products {
+		for j := range products[i].Variants {
+			displayCurrency.convertVariant(&products[i].Variants[j])
+		}
+	}
+	for i := range promotions {
+		for j := range promotions[i].Variants {
+			displayCurrency.convertVariant(&promotions[i].Variants[j])
+		}
+	}
+
 	// Calculate total pages
 	totalPages := int(totalProducts) / limit
 	if int(totalProducts)%limit != 0 {
@@ -184,10 +244,12 @@ func (h *GeneralHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"message":      "Successfully fetched results",
 		"products":     products,
+		"promotions":   promotionsByProduct(products, promotions),
 		"currentPage":  page,
 		"totalPages":   totalPages,
 		"totalItems":   totalProducts,
 		"itemsPerPage": limit,
+		"currency":     displayCurrency.Code,
 	})
 }
 
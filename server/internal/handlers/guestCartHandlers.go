@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/auth"
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+// cartTokenHeader carries the token of a guest cart in requests and responses
+const cartTokenHeader = "X-Cart-Token"
+
+var errGuestCartNotFound = errors.New("cart not found, the cart token is invalid or expired")
+
+// cartOwner is who a cart belongs to, a logged in user or a guest cart
+type cartOwner struct {
+	UserID    *uint
+	GuestCart *models.GuestCart
+}
+
+// scope restricts a cart item query to the owner's items
+func (o cartOwner) scope(tx *gorm.DB) *gorm.DB {
+	if o.UserID != nil {
+		return tx.Where("user_id = ?", *o.UserID)
+	}
+	return tx.Where("guest_cart_id = ?", o.GuestCart.ID)
+}
+
+// exists reports whether there is a cart to read from, a guest without a token has none yet
+func (o cartOwner) exists() bool {
+	return o.UserID != nil || o.GuestCart != nil
+}
+
+// newCartItem creates an item owned by the owner
+func (o cartOwner) newCartItem(variantID uint, quantity uint) models.CartItem {
+	cartItem := models.CartItem{
+		VariantID: variantID,
+		Quantity:  quantity,
+	}
+	if o.UserID != nil {
+		cartItem.UserID = o.UserID
+	} else {
+		cartItem.GuestCartID = &o.GuestCart.ID
+	}
+	return cartItem
+}
+
+// findGuestCart loads the guest cart a token points to
+func findGuestCart(tx *gorm.DB, token string) (*models.GuestCart, error) {
+	var guestCart models.GuestCart
+	result := tx.Where("token = ?", token).First(&guestCart)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errGuestCartNotFound
+		}
+		return nil, result.Error
+	}
+	return &guestCart, nil
+}
+
+// requestCartOwner works out whose cart a request is about. Logged in users always use their own cart,
+// otherwise the X-Cart-Token header picks the guest cart. When create is set a guest without a token
+// gets a new cart and its token is sent back in the X-Cart-Token response header.
+func requestCartOwner(w http.ResponseWriter, r *http.Request, create bool) (cartOwner, error) {
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		id := uint(userID)
+		return cartOwner{UserID: &id}, nil
+	}
+
+	if token := r.Header.Get(cartTokenHeader); token != "" {
+		guestCart, err := findGuestCart(db.DB.DB, token)
+		if err != nil {
+			return cartOwner{}, err
+		}
+		return cartOwner{GuestCart: guestCart}, nil
+	}
+
+	if !create {
+		return cartOwner{}, nil
+	}
+
+	token, err := auth.RandomToken(32)
+	if err != nil {
+		return cartOwner{}, err
+	}
+	guestCart := models.GuestCart{Token: token}
+	if result := db.DB.DB.Create(&guestCart); result.Error != nil {
+		return cartOwner{}, result.Error
+	}
+	w.Header().Set(cartTokenHeader, token)
+
+	return cartOwner{GuestCart: &guestCart}, nil
+}
+
+// cartMergeAdjustment reports a guest line that couldn't be merged in full because of stock
+type cartMergeAdjustment struct {
+	VariantID uint `json:"variantID"`
+	Requested uint `json:"requested"`
+	Quantity  uint `json:"quantity"`
+}
+
+// cartMergeResult describes what happened to a guest cart merged at login
+type cartMergeResult struct {
+	Merged   int                   `json:"merged"`
+	Adjusted []cartMergeAdjustment `json:"adjusted"`
+}
+
+// mergeGuestCart moves the items of a guest cart into the user's cart and deletes the guest cart.
+// Lines for the same variant are added together and every line is capped at the stock left.
+func mergeGuestCart(tx *gorm.DB, token string, userID uint) (*cartMergeResult, error) {
+	guestCart, err := findGuestCart(tx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var guestItems []models.CartItem
+	result := tx.Preload("Variant").Preload("Variant.Inventory").Where("guest_cart_id = ?", guestCart.ID).Find(&guestItems)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	mergeResult := &cartMergeResult{Adjusted: []cartMergeAdjustment{}}
+	for _, guestItem := range guestItems {
+		if guestItem.Variant.ID == 0 {
+			continue
+		}
+
+		var userItem models.CartItem
+		result = tx.Where("user_id = ? AND variant_id = ?", userID, guestItem.VariantID).Limit(1).Find(&userItem)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		// The guest units are capped at the stock left, the user's own line is never shrunk
+		requested := userItem.Quantity + guestItem.Quantity
+		quantity := requested
+		if stock := guestItem.Variant.Inventory.Quantity; quantity > stock {
+			quantity = max(stock, userItem.Quantity)
+			mergeResult.Adjusted = append(mergeResult.Adjusted, cartMergeAdjustment{
+				VariantID: guestItem.VariantID,
+				Requested: requested,
+				Quantity:  quantity,
+			})
+		}
+		if quantity == userItem.Quantity {
+			continue
+		}
+
+		if userItem.ID != 0 {
+			result = tx.Model(&userItem).Update("quantity", quantity)
+		} else {
+			result = tx.Create(&models.CartItem{
+				UserID:    &userID,
+				VariantID: guestItem.VariantID,
+				Quantity:  quantity,
+				UnitPrice: guestItem.UnitPrice,
+			})
+		}
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		mergeResult.Merged++
+	}
+
+	if result := tx.Unscoped().Where("guest_cart_id = ?", guestCart.ID).Delete(&models.CartItem{}); result.Error != nil {
+		return nil, result.Error
+	}
+	if result := tx.Unscoped().Delete(guestCart); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return mergeResult, nil
+}
@@ -0,0 +1,1019 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/payments"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// stockShortage describes a variant that doesn't have enough inventory to fill an order
+type stockShortage struct {
+	VariantID uint   `json:"variantID"`
+	Name      string `json:"name"`
+	Requested uint   `json:"requested"`
+	Available uint   `json:"available"`
+}
+
+// reserveInventory locks the inventory rows of the order items and decrements them.
+// Nothing is decremented when at least one variant is short, the shortages are returned instead.
+func reserveInventory(tx *gorm.DB, orderItems []models.OrderItem) ([]stockShortage, error) {
+	requested := make(map[uint]uint)
+	var variantIDs []uint
+	for _, orderItem := range orderItems {
+		if _, ok := requested[orderItem.VariantID]; !ok {
+			variantIDs = append(variantIDs, orderItem.VariantID)
+		}
+		requested[orderItem.VariantID] += uint(orderItem.Quantity)
+	}
+
+	// Always lock in the same order so concurrent checkouts can't deadlock each other
+	sort.Slice(variantIDs, func(i, j int) bool { return variantIDs[i] < variantIDs[j] })
+
+	var inventories []models.Inventory
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("variant_id IN ?", variantIDs).Order("variant_id").Find(&inventories)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	available := make(map[uint]models.Inventory)
+	for _, inventory := range inventories {
+		available[inventory.VariantID] = inventory
+	}
+
+	var shortages []stockShortage
+	for _, variantID := range variantIDs {
+		inventory := available[variantID]
+		if inventory.Quantity < requested[variantID] {
+			shortages = append(shortages, stockShortage{
+				VariantID: variantID,
+				Requested: requested[variantID],
+				Available: inventory.Quantity,
+			})
+		}
+	}
+	if len(shortages) > 0 {
+		for i := range shortages {
+			var variant models.Variant
+			if err := tx.Select("id", "name").First(&variant, shortages[i].VariantID).Error; err == nil {
+				shortages[i].Name = variant.Name
+			}
+		}
+		return shortages, nil
+	}
+
+	for _, variantID := range variantIDs {
+		inventory := available[variantID]
+		result := tx.Model(&inventory).Update("quantity", gorm.Expr("quantity - ?", requested[variantID]))
+		if result.Error != nil {
+			return nil, result.Error
+		}
+	}
+
+	return nil, nil
+}
+
+// cancellableOrderStatuses are the statuses in which customers may cancel their own order
+var cancellableOrderStatuses = []models.OrderStatus{models.OrderStatusPending, models.OrderStatusPaymentFailed, models.OrderStatusPaid}
+
+// orderSortColumns maps the sort query values accepted by the admin order list to their columns
+var orderSortColumns = map[string]string{
+	"createdAt": "orders.created_at",
+	"subtotal":  "orders.subtotal",
+	"total":     "orders.total",
+	"status":    "orders.status",
+}
+
+// selectPublicUserFields keeps sensitive user columns out of preloaded users
+func selectPublicUserFields(db *gorm.DB) *gorm.DB {
+	return db.Select("id", "email", "username", "created_at", "phone_number")
+}
+
+// parseDateParam parses a date filter given either as YYYY-MM-DD or RFC3339.
+// Plain dates used as an upper bound cover the whole day.
+func parseDateParam(value string, upperBound bool) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upperBound {
+		parsed = parsed.Add(24*time.Hour - time.Nanosecond)
+	}
+	return parsed, nil
+}
+
+// restoreInventory puts the quantities of the order items back into their inventory rows
+func restoreInventory(tx *gorm.DB, orderItems []models.OrderItem) error {
+	restored := make(map[uint]uint)
+	var variantIDs []uint
+	for _, orderItem := range orderItems {
+		if _, ok := restored[orderItem.VariantID]; !ok {
+			variantIDs = append(variantIDs, orderItem.VariantID)
+		}
+		restored[orderItem.VariantID] += uint(orderItem.Quantity)
+	}
+
+	// Same lock order as reserveInventory
+	sort.Slice(variantIDs, func(i, j int) bool { return variantIDs[i] < variantIDs[j] })
+
+	var inventories []models.Inventory
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("variant_id IN ?", variantIDs).Order("variant_id").Find(&inventories)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, inventory := range inventories {
+		result := tx.Model(&inventory).Update("quantity", gorm.Expr("quantity + ?", restored[inventory.VariantID]))
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+
+	return nil
+}
+
+// changeOrderStatus moves the order to next and records who changed it in the status history.
+// changedByID is nil when the change wasn't made by a user (payments, carriers...).
+func changeOrderStatus(tx *gorm.DB, order *models.Order, next models.OrderStatus, changedByID *uint, note string) error {
+	if err := order.Status.ValidateTransition(next); err != nil {
+		return err
+	}
+
+	history := models.OrderStatusHistory{
+		OrderID:     order.ID,
+		FromStatus:  order.Status,
+		ToStatus:    next,
+		ChangedByID: changedByID,
+		Note:        note,
+	}
+
+	result := tx.Model(order).Update("status", next)
+	if result.Error != nil {
+		return result.Error
+	}
+	order.Status = next
+
+	return tx.Create(&history).Error
+}
+
+// ======================
+// Checkout
+// ======================
+
+// releaseReservation cancels a pending order that couldn't be paid for and gives its stock and coupon use back
+func releaseReservation(orderID uint, reason string) error {
+	return db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").First(&order, orderID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if order.Status != models.OrderStatusPending {
+			return nil
+		}
+
+		if err := restoreInventory(tx, order.OrderItems); err != nil {
+			return err
+		}
+		if err := releaseCoupon(tx, order); err != nil {
+			return err
+		}
+		if err := changeOrderStatus(tx, &order, models.OrderStatusCancelled, nil, reason); err != nil {
+			return err
+		}
+		return tx.Model(&order).Update("cancel_reason", reason).Error
+	})
+}
+
+// unpaidOrderStatuses are the statuses of orders that hold stock without having been paid for
+var unpaidOrderStatuses = []models.OrderStatus{models.OrderStatusPending, models.OrderStatusPaymentFailed}
+
+// ExpireUnpaidOrders cancels the orders placed before the cutoff that still aren't paid, the same way
+// a cancellation does: stock and coupon use come back and a hold on the payment is released.
+// An order that fails to expire is logged and left for the next run. It returns how many expired.
+func (h *Handler) ExpireUnpaidOrders(ctx context.Context, placedBefore time.Time) (int, error) {
+	var orderIDs []uint
+	result := db.DB.DB.Model(&models.Order{}).
+		Where("status IN ? AND created_at < ?", unpaidOrderStatuses, placedBefore).
+		Order("id").Pluck("id", &orderIDs)
+	if result.Error != nil {
+		return 0, fmt.Errorf("find unpaid orders: %w", result.Error)
+	}
+
+	expired := 0
+	for _, orderID := range orderIDs {
+		if err := ctx.Err(); err != nil {
+			return expired, err
+		}
+
+		ok, err := h.expireUnpaidOrder(ctx, orderID)
+		if err != nil {
+			log.Printf("failed to expire unpaid order %d: %v", orderID, err)
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// expireUnpaidOrder cancels one unpaid order, it reports false when the order got paid or cancelled meanwhile
+func (h *Handler) expireUnpaidOrder(ctx context.Context, orderID uint) (bool, error) {
+	const reason = "Order expired before it was paid"
+
+	expired := false
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").First(&order, orderID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaymentFailed {
+			return nil
+		}
+
+		if err := restoreInventory(tx, order.OrderItems); err != nil {
+			return err
+		}
+		if err := releaseCoupon(tx, order); err != nil {
+			return err
+		}
+		if err := changeOrderStatus(tx, &order, models.OrderStatusCancelled, nil, reason); err != nil {
+			return err
+		}
+		if err := tx.Model(&order).Update("cancel_reason", reason).Error; err != nil {
+			return err
+		}
+
+		// The money goes back last, once every local change is made
+		if err := h.refundCancelledOrder(ctx, tx, order.ID); err != nil {
+			return err
+		}
+		expired = true
+		return nil
+	})
+	return expired, err
+}
+
+// PostCheckout turns the user's cart into an order bound to one of their addresses
+func (h *UserHandler) PostCheckout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var payload struct {
+		AddressID        uint   `json:"addressID"`
+		ShippingMethodID uint   `json:"shippingMethodID"`
+		PaymentSource    string `json:"paymentSource"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.AddressID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("address ID is required"))
+		return
+	}
+
+	if payload.ShippingMethodID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("shipping method ID is required"))
+		return
+	}
+
+	if payload.PaymentSource == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("payment details are required"))
+		return
+	}
+
+	if err := requireVerifiedEmail(db.DB.DB, uint(userID)); err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			utils.WriteError(w, http.StatusForbidden, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with checking your account, try again"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// The shipping address has to belong to the user placing the order
+	var address models.Address
+	result := tx.Where("id = ? AND user_id = ?", payload.AddressID, userID).First(&address)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("address not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	var cartItems []models.CartItem
+	result = tx.Preload("Variant").Preload("Variant.Product").Where("user_id = ?", userID).Find(&cartItems)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	if len(cartItems) == 0 {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusBadRequest, errors.New("cart is empty"))
+		return
+	}
+
+	var shippingMethod models.ShippingMethod
+	result = tx.Preload("Rates").Where("id = ? AND active = ?", payload.ShippingMethodID, true).First(&shippingMethod)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("shipping method not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	for _, cartItem := range cartItems {
+		if cartItem.Variant.ID == 0 {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusConflict, errors.New("a product in your cart is no longer available"))
+			return
+		}
+	}
+
+	// The applied coupon is checked again, it may have expired or run out since it was added to the cart
+	var cartCoupon models.CartCoupon
+	result = tx.Where("user_id = ?", userID).Limit(1).Find(&cartCoupon)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	var coupon *models.Coupon
+	if cartCoupon.ID != 0 {
+		coupon = &models.Coupon{}
+		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Categories").Preload("Brands").Preload("Variants").
+			First(coupon, cartCoupon.CouponID)
+		if result.Error != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+			return
+		}
+	}
+
+	pricing, err := priceCart(tx, uint(userID), cartItems, coupon, &address, &shippingMethod)
+	if err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+	if pricing.ShippingUnavailable {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, errors.New("this shipping method can't deliver your cart to the selected address"))
+		return
+	}
+	if pricing.couponErr != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("coupon %s can't be used: %w", coupon.Code, pricing.couponErr))
+		return
+	}
+	discount := pricing.Coupon
+
+	order := models.Order{
+		UserID:           uint(userID),
+		AddressID:        address.ID,
+		Status:           models.OrderStatusPending,
+		Currency:         config.Envs.BaseCurrency,
+		ShippingMethodID: &shippingMethod.ID,
+		Subtotal:         pricing.Subtotal,
+		DiscountTotal:    pricing.DiscountTotal,
+		TaxTotal:         pricing.TaxTotal,
+		ShippingCost:     pricing.ShippingCost,
+		Total:            pricing.Total,
+	}
+	if discount != nil {
+		order.CouponID = &discount.Coupon.ID
+		order.CouponCode = discount.Coupon.Code
+	}
+
+	// Snapshot the current variant prices and taxes so later changes don't affect the order
+	for _, line := range pricing.Lines {
+		order.OrderItems = append(order.OrderItems, models.OrderItem{
+			VariantID: line.VariantID,
+			Quantity:  int(line.Quantity),
+			Price:     line.UnitPrice,
+			TaxRate:   line.TaxRate,
+			Tax:       line.Tax,
+			Discount:  line.Discount,
+		})
+	}
+
+	// Lock and decrement stock before the order exists so two shoppers can't buy the same last unit
+	shortages, err := reserveInventory(tx, order.OrderItems)
+	if err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+	if len(shortages) > 0 {
+		tx.Rollback()
+		utils.WriteJson(w, http.StatusConflict, map[string]interface{}{
+			"error": map[string]interface{}{
+				"msg":       "some items in your cart don't have enough stock",
+				"shortages": shortages,
+			},
+		})
+		return
+	}
+
+	result = tx.Create(&order)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	placedBy := uint(userID)
+	result = tx.Create(&models.OrderStatusHistory{
+		OrderID:     order.ID,
+		ToStatus:    models.OrderStatusPending,
+		ChangedByID: &placedBy,
+		Note:        "Order placed",
+	})
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	if discount != nil {
+		result = tx.Create(&models.CouponRedemption{
+			CouponID: discount.Coupon.ID,
+			UserID:   uint(userID),
+			OrderID:  order.ID,
+			Amount:   discount.Discount,
+		})
+		if result.Error == nil {
+			result = tx.Model(&discount.Coupon).Update("times_used", gorm.Expr("times_used + 1"))
+		}
+		if result.Error != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+			return
+		}
+	}
+
+	// Commit the reservation before talking to the provider so a slow gateway doesn't hold the stock and coupon locks
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	authorization, err := h.payments.Authorize(r.Context(), payments.AuthorizeRequest{
+		OrderID:  order.ID,
+		Amount:   order.Total,
+		Currency: order.Currency,
+		Source:   payload.PaymentSource,
+	})
+	if err != nil {
+		// A declined card gives the stock and coupon back, the cart was left untouched
+		if releaseErr := releaseReservation(order.ID, "Payment was declined"); releaseErr != nil {
+			log.Printf("failed to release the reservation of order %d: %v", order.ID, releaseErr)
+		}
+		if errors.Is(err, payments.ErrCardDeclined) || errors.Is(err, payments.ErrInvalidCard) {
+			utils.WriteError(w, http.StatusPaymentRequired, err)
+			return
+		}
+		utils.WriteError(w, http.StatusBadGateway, errors.New("payment could not be processed, try again"))
+		return
+	}
+
+	payment := models.Payment{
+		OrderID:   order.ID,
+		Provider:  h.payments.Name(),
+		Reference: authorization.Reference,
+		Amount:    authorization.Amount,
+		Status:    models.PaymentStatusAuthorized,
+	}
+	cartItemIDs := make([]uint, 0, len(cartItems))
+	for _, cartItem := range cartItems {
+		cartItemIDs = append(cartItemIDs, cartItem.ID)
+	}
+	err = db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		if result := tx.Create(&payment); result.Error != nil {
+			return result.Error
+		}
+
+		// Empty the cart now that its content belongs to the order
+		if result := tx.Where("id IN ?", cartItemIDs).Delete(&models.CartItem{}); result.Error != nil {
+			return result.Error
+		}
+		if discount != nil {
+			return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.CartCoupon{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		// Without its payment record the order can't go on, the hold is released along with the reservation
+		if _, voidErr := h.payments.Void(r.Context(), authorization.Reference); voidErr != nil {
+			log.Printf("failed to void authorization %s of order %d: %v", authorization.Reference, order.ID, voidErr)
+		}
+		if releaseErr := releaseReservation(order.ID, "Payment could not be recorded"); releaseErr != nil {
+			log.Printf("failed to release the reservation of order %d: %v", order.ID, releaseErr)
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with placing the order, try again"))
+		return
+	}
+
+	// The order is placed at this point, a failed capture leaves it pending until the provider confirms it
+	if err := h.capturePayment(r.Context(), &payment); err != nil {
+		log.Printf("capture of payment %d for order %d failed: %v", payment.ID, order.ID, err)
+	}
+
+	var placedOrder models.Order
+	result = db.DB.DB.Preload("OrderItems").Preload("OrderItems.Variant").Preload("OrderItems.Variant.Images").
+		Preload("Address").Preload("ShippingMethod").Preload("Payments").First(&placedOrder, order.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":      "Order placed successfully",
+		"order":        placedOrder,
+		"taxBreakdown": pricing.TaxBreakdown,
+		"promotions":   pricing.Promotions.Applied,
+	})
+}
+
+// ======================
+// User Orders
+// ======================
+
+// GetOrders lists the user's orders, newest first
+func (h *UserHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	status := models.OrderStatus(r.URL.Query().Get("status"))
+
+	// Default values for pagination
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+
+	offset := (page - 1) * limit
+
+	baseQuery := db.DB.DB.Model(&models.Order{}).Where("user_id = ?", userID)
+
+	if status != "" {
+		if !status.IsValid() {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid order status"))
+			return
+		}
+		baseQuery = baseQuery.Where("status = ?", status)
+	}
+
+	var totalOrders int64
+	if err := baseQuery.Count(&totalOrders).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting orders, try again"))
+		return
+	}
+
+	var orders []models.Order
+	result := baseQuery.Preload("OrderItems").Preload("OrderItems.Variant").Preload("OrderItems.Variant.Images").
+		Order("created_at DESC").Offset(offset).Limit(limit).Find(&orders)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting orders, try again"))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(totalOrders) / float64(limit)))
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":      "Successfully fetched results",
+		"orders":       orders,
+		"currentPage":  page,
+		"totalPages":   totalPages,
+		"totalItems":   totalOrders,
+		"itemsPerPage": limit,
+	})
+}
+
+// GetOrder returns a single order of the user with its items and shipping address
+func (h *UserHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var order models.Order
+	result := db.DB.DB.Preload("OrderItems").Preload("OrderItems.Variant").Preload("OrderItems.Variant.Images").
+		Preload("Address").Preload("ShippingMethod").Preload("Shipments").Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).Where("id = ? AND user_id = ?", orderID, userID).First(&order)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting the order, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Fetched order",
+		"order":   order,
+	})
+}
+
+// PostCancelOrder lets users cancel their own order while it hasn't been processed yet
+func (h *UserHandler) PostCancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var payload struct {
+		Reason string `json:"reason"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order models.Order
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").
+		Where("id = ? AND user_id = ?", orderID, userID).First(&order)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with cancelling the order, try again"))
+		return
+	}
+
+	cancellable := false
+	for _, status := range cancellableOrderStatuses {
+		if order.Status == status {
+			cancellable = true
+		}
+	}
+	if !cancellable {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, errors.New("only orders that haven't been processed yet can be cancelled"))
+		return
+	}
+
+	if err := restoreInventory(tx, order.OrderItems); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with cancelling the order, try again"))
+		return
+	}
+
+	if err := releaseCoupon(tx, order); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with cancelling the order, try again"))
+		return
+	}
+
+	cancelledBy := uint(userID)
+	if err := changeOrderStatus(tx, &order, models.OrderStatusCancelled, &cancelledBy, payload.Reason); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with cancelling the order, try again"))
+		return
+	}
+
+	result = tx.Model(&order).Update("cancel_reason", payload.Reason)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with cancelling the order, try again"))
+		return
+	}
+	order.CancelReason = payload.Reason
+
+	// The money goes back last, once every local change is made
+	if err := h.refundCancelledOrder(r.Context(), tx, order.ID); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusBadGateway, fmt.Errorf("payment could not be refunded: %w", err))
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Order was cancelled",
+		"order":   order,
+	})
+}
+
+// ======================
+// Order Management
+// ======================
+
+// GetAllOrders lists every order with filters on status, dates, customer email and total
+func (h *AdminHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 10
+	}
+
+	offset := (page - 1) * limit
+
+	baseQuery := db.DB.DB.Model(&models.Order{}).Joins("JOIN users ON users.id = orders.user_id")
+
+	if status := models.OrderStatus(query.Get("status")); status != "" {
+		if !status.IsValid() {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid order status"))
+			return
+		}
+		baseQuery = baseQuery.Where("orders.status = ?", status)
+	}
+
+	if from := query.Get("from"); from != "" {
+		fromDate, err := parseDateParam(from, false)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid from date"))
+			return
+		}
+		baseQuery = baseQuery.Where("orders.created_at >= ?", fromDate)
+	}
+
+	if to := query.Get("to"); to != "" {
+		toDate, err := parseDateParam(to, true)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid to date"))
+			return
+		}
+		baseQuery = baseQuery.Where("orders.created_at <= ?", toDate)
+	}
+
+	if email := query.Get("email"); email != "" {
+		baseQuery = baseQuery.Where("users.email ILIKE ?", "%"+email+"%")
+	}
+
+	if minTotal := query.Get("minTotal"); minTotal != "" {
+		value, err := models.ParseMoney(minTotal)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid minTotal parameter"))
+			return
+		}
+		baseQuery = baseQuery.Where("orders.total >= ?", value)
+	}
+
+	if maxTotal := query.Get("maxTotal"); maxTotal != "" {
+		value, err := models.ParseMoney(maxTotal)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid maxTotal parameter"))
+			return
+		}
+		baseQuery = baseQuery.Where("orders.total <= ?", value)
+	}
+
+	sortColumn := orderSortColumns["createdAt"]
+	if sortBy := query.Get("sort"); sortBy != "" {
+		column, ok := orderSortColumns[sortBy]
+		if !ok {
+			utils.WriteError(w, http.StatusBadRequest, errors.New("invalid sort parameter"))
+			return
+		}
+		sortColumn = column
+	}
+	sortDirection := "DESC"
+	if query.Get("order") == "asc" {
+		sortDirection = "ASC"
+	}
+
+	var total int64
+	if err := baseQuery.Count(&total).Error; err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("error counting orders"))
+		return
+	}
+
+	var orders []models.Order
+	result := baseQuery.Select("orders.*").Preload("User", selectPublicUserFields).Preload("OrderItems").
+		Order(sortColumn + " " + sortDirection).Limit(limit).Offset(offset).Find(&orders)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("error fetching orders"))
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"orders": orders,
+		"pagination": map[string]interface{}{
+			"currentPage":  page,
+			"totalPages":   totalPages,
+			"totalItems":   total,
+			"itemsPerPage": limit,
+		},
+	})
+}
+
+// GetOrderDetails returns the full order including the customer who placed it
+func (h *AdminHandler) GetOrderDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var order models.Order
+	result := db.DB.DB.Preload("User", selectPublicUserFields).Preload("Address").Preload("ShippingMethod").
+		Preload("Payments").Preload("Refunds").Preload("Refunds.Items").Preload("Shipments").Preload("OrderItems").Preload("OrderItems.Variant").Preload("OrderItems.Variant.Images").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).First(&order, orderID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("error fetching order"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Fetched order",
+		"order":   order,
+	})
+}
+
+// PutOrderStatus moves an order to a new status if the transition is allowed and the status can be set by hand
+func (h *AdminHandler) PutOrderStatus(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("unauthorized access"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var payload struct {
+		Status models.OrderStatus `json:"status"`
+		Note   string             `json:"note"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !payload.Status.IsValid() {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid order status"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order models.Order
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").Where("id = ?", orderID).First(&order)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the order, try again"))
+		return
+	}
+
+	if err := order.Status.ValidateAdminTransition(payload.Status); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	// Cancelled orders give their stock, money and coupon use back
+	if payload.Status == models.OrderStatusCancelled {
+		if err := restoreInventory(tx, order.OrderItems); err != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the order, try again"))
+			return
+		}
+
+		if err := releaseCoupon(tx, order); err != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the order, try again"))
+			return
+		}
+	}
+
+	changedBy := uint(adminID)
+	if err := changeOrderStatus(tx, &order, payload.Status, &changedBy, payload.Note); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the order, try again"))
+		return
+	}
+
+	// The money of a cancelled order goes back last, once every local change is made
+	if payload.Status == models.OrderStatusCancelled {
+		if err := h.refundCancelledOrder(r.Context(), tx, order.ID); err != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusBadGateway, fmt.Errorf("payment could not be refunded: %w", err))
+			return
+		}
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	var updatedOrder models.Order
+	result = db.DB.DB.Preload("StatusHistory", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).First(&updatedOrder, order.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Order status updated",
+		"order":   updatedOrder,
+	})
+}
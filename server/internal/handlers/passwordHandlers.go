@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/auth"
+	"github.com/Brondont/E-Com-shop/internal/notify"
+	"github.com/Brondont/E-Com-shop/internal/ratelimit"
+	"github.com/Brondont/E-Com-shop/middleware"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+)
+
+// mailTimeout bounds how long an email triggered by a request may take to go out
+const mailTimeout = 30 * time.Second
+
+var errPasswordResetInvalid = errors.New("the password reset link is invalid or expired")
+
+// Password reset requests are limited per email so an inbox can't be flooded, and per IP so one
+// client can't walk through many addresses
+var (
+	passwordResetEmailLimiter = ratelimit.NewLimiter(3, time.Hour)
+	passwordResetIPLimiter    = ratelimit.NewLimiter(20, time.Hour)
+)
+
+// sendMail delivers a message in the background so the response time doesn't depend on the mail server,
+// a failure is only logged
+func (h *Handler) sendMail(msg notify.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := h.notifier.Send(ctx, msg); err != nil {
+			log.Printf("failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// createPasswordResetToken replaces the user's pending reset tokens with a new one and returns the raw token
+func createPasswordResetToken(tx *gorm.DB, userID uint) (string, error) {
+	rawToken, err := auth.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the latest link works, older ones are spent
+	result := tx.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return "", result.Error
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    userID,
+		TokenHash: auth.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(config.Envs.PasswordResetTTL),
+	}
+	if result := tx.Create(&resetToken); result.Error != nil {
+		return "", result.Error
+	}
+
+	return rawToken, nil
+}
+
+// passwordResetMessage writes the email carrying the reset link
+func passwordResetMessage(user models.User, rawToken string) notify.Message {
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.Envs.ClientURL, url.QueryEscape(rawToken))
+	return notify.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password of your account. Open this link to choose a new one:\n%s\n\nThe link works once and expires in %s. If you didn't ask for it you can ignore this email.",
+			user.Username, link, config.Envs.PasswordResetTTL,
+		),
+	}
+}
+
+// sendPasswordReset looks up the account of the lowercased email and mails it a reset link. It runs in the
+// background for every request so the response time doesn't tell whether the account exists.
+func (h *UserHandler) sendPasswordReset(email string) {
+	go func() {
+		var user models.User
+		result := db.DB.DB.Where("LOWER(email) = ?", email).Limit(1).Find(&user)
+		if result.Error != nil {
+			log.Printf("failed to look up the account for a password reset: %v", result.Error)
+			return
+		}
+		if user.ID == 0 {
+			return
+		}
+
+		rawToken, err := createPasswordResetToken(db.DB.DB, user.ID)
+		if err != nil {
+			log.Printf("failed to create a password reset token for user %d: %v", user.ID, err)
+			return
+		}
+		h.sendMail(passwordResetMessage(user, rawToken))
+	}()
+}
+
+// PostForgotPassword emails a password reset link. The answer is the same, and comes as fast, whether
+// or not the email belongs to an account so the endpoint can't be used to find out who has one.
+func (h *UserHandler) PostForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Addresses are matched without case so changing it can't dodge the limit or miss the account
+	email := strings.ToLower(strings.TrimSpace(payload.Email))
+	if email == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("email is required"))
+		return
+	}
+
+	now := time.Now()
+	if !passwordResetIPLimiter.Allow(clientIP(r), now) || !passwordResetEmailLimiter.Allow(email, now) {
+		utils.WriteError(w, http.StatusTooManyRequests, errors.New("too many password reset requests, try again later"))
+		return
+	}
+
+	h.sendPasswordReset(email)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "If an account uses this email, a link to reset its password is on its way",
+	})
+}
+
+// PostResetPassword sets a new password with a token from a reset email. The token is spent and
+// every session of the user is ended so whoever knew the old password is logged out.
+func (h *UserHandler) PostResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.Token == "" {
+		utils.WriteError(w, http.StatusBadRequest, errPasswordResetInvalid)
+		return
+	}
+	if errs := middleware.ValidateNewPassword(payload.Password); len(errs) != 0 {
+		utils.WriteInputValidationError(w, http.StatusConflict, errs)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var resetToken models.PasswordResetToken
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", auth.HashToken(payload.Token)).First(&resetToken)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return errPasswordResetInvalid
+			}
+			return result.Error
+		}
+		if resetToken.UsedAt != nil || time.Now().After(resetToken.ExpiresAt) {
+			return errPasswordResetInvalid
+		}
+
+		if err := tx.Model(&resetToken).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		// Opening the emailed link proves the address too
+		result = tx.Model(&models.User{}).Where("id = ?", resetToken.UserID).Updates(map[string]interface{}{
+			"password":          hashedPassword,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPasswordResetInvalid
+		}
+
+		_, err := revokeSessions(tx, "user_id = ?", resetToken.UserID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, errPasswordResetInvalid) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with resetting the password, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Password was reset, log in with the new password",
+	})
+}
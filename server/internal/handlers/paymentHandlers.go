@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/payments"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// captureAction is what capturePayment does with a payment given the state it finds it in
+type captureAction int
+
+const (
+	captureSkip captureAction = iota
+	captureCharge
+	captureVoid
+)
+
+// decideCapture only charges authorized payments of pending orders. An order cancelled before the
+// capture got to it has its hold released, a payment that moved on already is left alone.
+func decideCapture(orderStatus models.OrderStatus, paymentStatus models.PaymentStatus) captureAction {
+	if paymentStatus != models.PaymentStatusAuthorized {
+		return captureSkip
+	}
+	if orderStatus != models.OrderStatusPending {
+		return captureVoid
+	}
+	return captureCharge
+}
+
+// capturePayment captures an authorized payment and marks its order as paid. The order and payment are
+// locked and checked before the provider is called so a cancellation can't slip in between.
+func (h *Handler) capturePayment(ctx context.Context, payment *models.Payment) error {
+	return db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, payment.OrderID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(payment, payment.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		switch decideCapture(order.Status, payment.Status) {
+		case captureVoid:
+			return h.voidPayment(ctx, tx, payment)
+		case captureSkip:
+			return nil
+		}
+
+		transaction, err := h.payments.Capture(ctx, payment.Reference, payment.Amount)
+		if err != nil {
+			return err
+		}
+
+		result = tx.Model(payment).Updates(models.Payment{
+			Status: models.PaymentStatusCaptured,
+			Amount: transaction.Amount,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return changeOrderStatus(tx, &order, models.OrderStatusPaid, nil, "Payment captured")
+	})
+}
+
+// voidPayment releases the hold of an authorized payment and records it as voided
+func (h *Handler) voidPayment(ctx context.Context, tx *gorm.DB, payment *models.Payment) error {
+	if _, err := h.payments.Void(ctx, payment.Reference); err != nil {
+		return err
+	}
+
+	result := tx.Model(payment).Update("status", models.PaymentStatusVoided)
+	if result.Error != nil {
+		return result.Error
+	}
+	payment.Status = models.PaymentStatusVoided
+	return nil
+}
+
+// capturedPayment returns the locked payment of the order that still has money to refund
+func capturedPayment(tx *gorm.DB, orderID uint) (*models.Payment, error) {
+	var payment models.Payment
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status IN ?", orderID, []models.PaymentStatus{models.PaymentStatusCaptured, models.PaymentStatusPartiallyRefunded}).
+		Order("created_at DESC").First(&payment)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &payment, nil
+}
+
+// validateRefundAmount checks that amount is something the payment can still give back
+func validateRefundAmount(payment models.Payment, amount models.Money) error {
+	if amount <= 0 {
+		return fmt.Errorf("%w: there is nothing to refund", errRefundInvalid)
+	}
+	if remaining := payment.Amount - payment.AmountRefunded; amount > remaining {
+		return fmt.Errorf("%w: refund amount %s exceeds the %s left on the payment", errRefundNotAllowed, amount, remaining)
+	}
+	return nil
+}
+
+// refundIdempotencyKey names a refund by its payment and what was refunded before it, retrying a refund
+// whose transaction failed to commit gives the same key and the provider doesn't pay out twice
+func refundIdempotencyKey(payment models.Payment) string {
+	return fmt.Sprintf("payment_%d_after_%d", payment.ID, int64(payment.AmountRefunded))
+}
+
+// refundPayment records amount as refunded on the payment and then sends it back through the provider.
+// Callers do it last, once every other change of the transaction is made, so only the commit can fail after the provider.
+func (h *Handler) refundPayment(ctx context.Context, tx *gorm.DB, payment *models.Payment, amount models.Money) (*payments.Transaction, error) {
+	if err := validateRefundAmount(*payment, amount); err != nil {
+		return nil, err
+	}
+	idempotencyKey := refundIdempotencyKey(*payment)
+
+	refunded := payment.AmountRefunded + amount
+	status := models.PaymentStatusPartiallyRefunded
+	if refunded >= payment.Amount {
+		status = models.PaymentStatusRefunded
+	}
+
+	result := tx.Model(payment).Updates(map[string]interface{}{
+		"amount_refunded": refunded,
+		"status":          status,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	transaction, err := h.payments.Refund(ctx, payment.Reference, amount, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	payment.AmountRefunded = refunded
+	payment.Status = status
+
+	return transaction, nil
+}
+
+// refundCancelledOrder gives back whatever was captured for an order that is being cancelled
+// and releases the hold of a payment that was only authorized
+func (h *Handler) refundCancelledOrder(ctx context.Context, tx *gorm.DB, orderID uint) error {
+	var authorized models.Payment
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", orderID, models.PaymentStatusAuthorized).
+		Limit(1).Find(&authorized)
+	if result.Error != nil {
+		return result.Error
+	}
+	if authorized.ID != 0 {
+		return h.voidPayment(ctx, tx, &authorized)
+	}
+
+	payment, err := capturedPayment(tx, orderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = h.refundPayment(ctx, tx, payment, payment.Amount-payment.AmountRefunded)
+	return err
+}
+
+// ======================
+// Refund Management
+// ======================
+
+var (
+	errRefundInvalid    = errors.New("invalid refund")
+	errRefundNotAllowed = errors.New("refund not allowed")
+)
+
+// refundRequestItem is a quantity of an order item the admin wants to refund
+type refundRequestItem struct {
+	OrderItemID uint `json:"orderItemID"`
+	Quantity    int  `json:"quantity"`
+}
+
+// refundPlan is what a refund gives back, worked out from the order before anything is written
+type refundPlan struct {
+	Items         []models.RefundItem
+	Amount        models.Money
+	FullyRefunded bool
+}
+
+// planRefund works out the items and amount of a refund. Without requested items everything that
+// hasn't been refunded yet is refunded. Requests that can never work fail with errRefundInvalid,
+// ones the current state of the order rules out with errRefundNotAllowed.
+func planRefund(order models.Order, payment models.Payment, requestedItems []refundRequestItem) (*refundPlan, error) {
+	orderItems := make(map[uint]models.OrderItem)
+	for _, orderItem := range order.OrderItems {
+		orderItems[orderItem.ID] = orderItem
+	}
+
+	requested := make(map[uint]int)
+	if len(requestedItems) == 0 {
+		for _, orderItem := range order.OrderItems {
+			if left := orderItem.Quantity - orderItem.RefundedQuantity; left > 0 {
+				requested[orderItem.ID] = left
+			}
+		}
+		if len(requested) == 0 {
+			return nil, fmt.Errorf("%w: nothing left to refund on this order", errRefundNotAllowed)
+		}
+	}
+	for _, item := range requestedItems {
+		if _, ok := orderItems[item.OrderItemID]; !ok {
+			return nil, fmt.Errorf("%w: order item %d doesn't belong to this order", errRefundInvalid, item.OrderItemID)
+		}
+		if item.Quantity < 1 {
+			return nil, fmt.Errorf("%w: invalid quantity for order item %d", errRefundInvalid, item.OrderItemID)
+		}
+		requested[item.OrderItemID] += item.Quantity
+	}
+
+	plan := &refundPlan{FullyRefunded: true}
+	for _, orderItem := range order.OrderItems {
+		quantity := requested[orderItem.ID]
+		left := orderItem.Quantity - orderItem.RefundedQuantity
+		if quantity > left {
+			return nil, fmt.Errorf("%w: only %d of order item %d can still be refunded", errRefundNotAllowed, left, orderItem.ID)
+		}
+		if quantity < left {
+			plan.FullyRefunded = false
+		}
+		if quantity == 0 {
+			continue
+		}
+
+		// Refund the item's share of the line discount and tax along with its price
+		amount := orderItem.Price.Mul(quantity) -
+			orderItem.Discount.Fraction(quantity, orderItem.Quantity) +
+			orderItem.Tax.Fraction(quantity, orderItem.Quantity)
+		plan.Items = append(plan.Items, models.RefundItem{
+			OrderItemID: orderItem.ID,
+			Quantity:    quantity,
+			Amount:      amount,
+		})
+		plan.Amount += amount
+	}
+
+	// The last refund also gives back what isn't tied to an item, like shipping
+	if plan.FullyRefunded {
+		plan.Amount = payment.Amount - payment.AmountRefunded
+	}
+
+	if err := validateRefundAmount(payment, plan.Amount); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// writeRefundError answers a refund that failed before reaching the provider
+func writeRefundError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errRefundInvalid):
+		utils.WriteError(w, http.StatusBadRequest, err)
+	case errors.Is(err, errRefundNotAllowed):
+		utils.WriteError(w, http.StatusConflict, err)
+	default:
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+	}
+}
+
+// PostRefund refunds a whole order or selected quantities of its items, optionally putting them back in stock.
+// The request is checked against the order before the transaction, the provider is called once every local change is made.
+func (h *AdminHandler) PostRefund(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("unauthorized access"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var payload struct {
+		Items   []refundRequestItem `json:"items"`
+		Restock bool                `json:"restock"`
+		Reason  string              `json:"reason"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var current models.Order
+	result := db.DB.DB.Preload("OrderItems").First(&current, orderID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+		return
+	}
+	if !current.Status.CanTransitionTo(models.OrderStatusPartiallyRefunded) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("a %s order can't be refunded", current.Status))
+		return
+	}
+	currentPayment, err := capturedPayment(db.DB.DB, current.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusConflict, errors.New("order has no captured payment to refund"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+		return
+	}
+	if _, err := planRefund(current, *currentPayment, payload.Items); err != nil {
+		writeRefundError(w, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Work the refund out again under lock, another refund may have landed since the check
+	var order models.Order
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").First(&order, current.ID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+		return
+	}
+	if !order.Status.CanTransitionTo(models.OrderStatusPartiallyRefunded) {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("a %s order can't be refunded", order.Status))
+		return
+	}
+
+	payment, err := capturedPayment(tx, order.ID)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusConflict, errors.New("order has no captured payment to refund"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+		return
+	}
+
+	plan, err := planRefund(order, *payment, payload.Items)
+	if err != nil {
+		tx.Rollback()
+		writeRefundError(w, err)
+		return
+	}
+
+	orderItems := make(map[uint]*models.OrderItem)
+	for i := range order.OrderItems {
+		orderItems[order.OrderItems[i].ID] = &order.OrderItems[i]
+	}
+
+	var restocked []models.OrderItem
+	for _, item := range plan.Items {
+		orderItem := orderItems[item.OrderItemID]
+		orderItem.RefundedQuantity += item.Quantity
+		result := tx.Model(orderItem).Update("refunded_quantity", orderItem.RefundedQuantity)
+		if result.Error != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+			return
+		}
+
+		restocked = append(restocked, models.OrderItem{VariantID: orderItem.VariantID, Quantity: item.Quantity})
+	}
+
+	if payload.Restock {
+		if err := restoreInventory(tx, restocked); err != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+			return
+		}
+	}
+
+	refund := models.Refund{
+		OrderID:     order.ID,
+		PaymentID:   payment.ID,
+		Amount:      plan.Amount,
+		Reason:      payload.Reason,
+		Restocked:   payload.Restock,
+		CreatedByID: uint(adminID),
+		Items:       plan.Items,
+	}
+	result = tx.Create(&refund)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+		return
+	}
+
+	nextStatus := models.OrderStatusPartiallyRefunded
+	if plan.FullyRefunded {
+		nextStatus = models.OrderStatusRefunded
+	}
+
+	refundedBy := uint(adminID)
+	if err := changeOrderStatus(tx, &order, nextStatus, &refundedBy, payload.Reason); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refunding the order, try again"))
+		return
+	}
+
+	transaction, err := h.refundPayment(r.Context(), tx, payment, refund.Amount)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, errRefundInvalid) || errors.Is(err, errRefundNotAllowed) {
+			writeRefundError(w, err)
+			return
+		}
+		utils.WriteError(w, http.StatusBadGateway, fmt.Errorf("payment provider refused the refund: %w", err))
+		return
+	}
+
+	refund.ProviderReference = transaction.Reference
+	result = tx.Model(&refund).Update("provider_reference", refund.ProviderReference)
+	if result.Error == nil {
+		result = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if result.Error != nil {
+		// The provider refunded already, retrying the same refund reuses its idempotency key
+		log.Printf("refund %s of order %d went through the provider but wasn't saved: %v", transaction.Reference, order.ID, result.Error)
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("the refund was sent but couldn't be saved, retry it to record it"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message": "Refund issued",
+		"refund":  refund,
+		"order":   order,
+	})
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+func TestDecideCapture(t *testing.T) {
+	tests := []struct {
+		name          string
+		orderStatus   models.OrderStatus
+		paymentStatus models.PaymentStatus
+		want          captureAction
+	}{
+		{"authorized payment of a pending order is charged", models.OrderStatusPending, models.PaymentStatusAuthorized, captureCharge},
+		{"authorized payment of a cancelled order is voided", models.OrderStatusCancelled, models.PaymentStatusAuthorized, captureVoid},
+		{"authorized payment of a failed order is voided", models.OrderStatusPaymentFailed, models.PaymentStatusAuthorized, captureVoid},
+		{"payment captured by a webhook is skipped", models.OrderStatusPaid, models.PaymentStatusCaptured, captureSkip},
+		{"voided payment is skipped", models.OrderStatusCancelled, models.PaymentStatusVoided, captureSkip},
+		{"refunded payment is skipped", models.OrderStatusPending, models.PaymentStatusRefunded, captureSkip},
+		{"failed payment is skipped", models.OrderStatusPending, models.PaymentStatusFailed, captureSkip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideCapture(tt.orderStatus, tt.paymentStatus); got != tt.want {
+				t.Errorf("decideCapture(%s, %s) = %d, want %d", tt.orderStatus, tt.paymentStatus, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanRefund(t *testing.T) {
+	// Two lines: 2 x 10.00 with 1.00 tax and 2.00 discount, and 1 free gift. Shipping makes the total 25.00.
+	newOrder := func(refundedFirst, refundedGift int) models.Order {
+		order := models.Order{
+			OrderItems: []models.OrderItem{
+				{Quantity: 2, Price: 1000, Tax: 100, Discount: 200, RefundedQuantity: refundedFirst},
+				{Quantity: 1, Price: 0, RefundedQuantity: refundedGift},
+			},
+		}
+		order.OrderItems[0].ID = 1
+		order.OrderItems[1].ID = 2
+		return order
+	}
+	payment := models.Payment{Amount: 2500}
+
+	tests := []struct {
+		name      string
+		order     models.Order
+		payment   models.Payment
+		items     []refundRequestItem
+		wantErr   error
+		wantTotal models.Money
+		wantFull  bool
+	}{
+		{
+			name:      "everything left is refunded with shipping",
+			order:     newOrder(0, 0),
+			payment:   payment,
+			wantTotal: 2500,
+			wantFull:  true,
+		},
+		{
+			name:      "one unit gets its share of tax and discount",
+			order:     newOrder(0, 0),
+			payment:   payment,
+			items:     []refundRequestItem{{OrderItemID: 1, Quantity: 1}},
+			wantTotal: 1000 - 100 + 50,
+		},
+		{
+			name:      "last units refund what is left on the payment",
+			order:     newOrder(1, 1),
+			payment:   models.Payment{Amount: 2500, AmountRefunded: 950},
+			items:     []refundRequestItem{{OrderItemID: 1, Quantity: 1}},
+			wantTotal: 1550,
+			wantFull:  true,
+		},
+		{
+			name:    "free items alone add up to nothing",
+			order:   newOrder(0, 0),
+			payment: payment,
+			items:   []refundRequestItem{{OrderItemID: 2, Quantity: 1}},
+			wantErr: errRefundInvalid,
+		},
+		{
+			name:    "item of another order",
+			order:   newOrder(0, 0),
+			payment: payment,
+			items:   []refundRequestItem{{OrderItemID: 9, Quantity: 1}},
+			wantErr: errRefundInvalid,
+		},
+		{
+			name:    "zero quantity",
+			order:   newOrder(0, 0),
+			payment: payment,
+			items:   []refundRequestItem{{OrderItemID: 1, Quantity: 0}},
+			wantErr: errRefundInvalid,
+		},
+		{
+			name:    "more than is left",
+			order:   newOrder(1, 0),
+			payment: payment,
+			items:   []refundRequestItem{{OrderItemID: 1, Quantity: 1}, {OrderItemID: 1, Quantity: 1}},
+			wantErr: errRefundNotAllowed,
+		},
+		{
+			name:    "nothing left on the order",
+			order:   newOrder(2, 1),
+			payment: models.Payment{Amount: 2500, AmountRefunded: 2500},
+			wantErr: errRefundNotAllowed,
+		},
+		{
+			name:    "more than is left on the payment",
+			order:   newOrder(0, 0),
+			payment: models.Payment{Amount: 2500, AmountRefunded: 2000},
+			items:   []refundRequestItem{{OrderItemID: 1, Quantity: 1}},
+			wantErr: errRefundNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planRefund(tt.order, tt.payment, tt.items)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("planRefund() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planRefund() unexpected error: %v", err)
+			}
+			if plan.Amount != tt.wantTotal {
+				t.Errorf("planRefund() amount = %s, want %s", plan.Amount, tt.wantTotal)
+			}
+			if plan.FullyRefunded != tt.wantFull {
+				t.Errorf("planRefund() fully refunded = %t, want %t", plan.FullyRefunded, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestRefundIdempotencyKey(t *testing.T) {
+	payment := models.Payment{Amount: 2500, AmountRefunded: 500}
+	payment.ID = 7
+
+	retried := payment
+	if refundIdempotencyKey(payment) != refundIdempotencyKey(retried) {
+		t.Error("a retried refund should reuse its idempotency key")
+	}
+
+	next := payment
+	next.AmountRefunded = 1000
+	if refundIdempotencyKey(payment) == refundIdempotencyKey(next) {
+		t.Error("a later refund of the same payment should get a new idempotency key")
+	}
+}
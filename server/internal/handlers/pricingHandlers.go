@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+// cartLine is the priced view of one cart item
+type cartLine struct {
+	CartItemID uint         `json:"cartItemID"`
+	VariantID  uint         `json:"variantID"`
+	Name       string       `json:"name"`
+	Quantity   uint         `json:"quantity"`
+	UnitPrice  models.Money `json:"unitPrice"`
+	LineTotal  models.Money `json:"lineTotal"`
+	Discount   models.Money `json:"discount"`
+	TaxRate    float64      `json:"taxRate"`
+	Tax        models.Money `json:"tax"`
+	Total      models.Money `json:"total"`
+	// PriceChanged is set when the variant no longer sells for the price it had when it was added
+	PriceChanged      bool          `json:"priceChanged"`
+	PreviousUnitPrice *models.Money `json:"previousUnitPrice,omitempty"`
+	// StockChanged is set when the stock left can't cover the quantity in the cart anymore
+	StockChanged      bool `json:"stockChanged"`
+	AvailableQuantity uint `json:"availableQuantity"`
+}
+
+// cartPricing is the outcome of running a cart through promotions, the coupon, shipping and taxes.
+// Checkout and the cart summary both use it so the shopper sees what they will be charged.
+type cartPricing struct {
+	Lines          []cartLine             `json:"lines"`
+	Subtotal       models.Money           `json:"subtotal"`
+	DiscountTotal  models.Money           `json:"discountTotal"`
+	TaxTotal       models.Money           `json:"taxTotal"`
+	ShippingCost   models.Money           `json:"shippingCost"`
+	Total          models.Money           `json:"total"`
+	Promotions     promotionResult        `json:"promotions"`
+	Coupon         *couponResult          `json:"coupon,omitempty"`
+	ShippingMethod *models.ShippingMethod `json:"shippingMethod,omitempty"`
+	TaxBreakdown   []taxLine              `json:"taxBreakdown"`
+
+	// CouponError explains why the coupon applied to the cart was left out
+	CouponError string `json:"couponError,omitempty"`
+	// ShippingUnavailable is set when the shipping method can't deliver the cart to the address
+	ShippingUnavailable bool `json:"shippingUnavailable,omitempty"`
+
+	couponErr error
+}
+
+// priceCart computes what a cart costs. The coupon, address and shipping method are optional,
+// without an address no tax is estimated and without a shipping method shipping is left at zero.
+// Cart items need their variant and its product loaded, the inventory too for the stock flags.
+func priceCart(tx *gorm.DB, userID uint, cartItems []models.CartItem, coupon *models.Coupon, address *models.Address, shippingMethod *models.ShippingMethod) (*cartPricing, error) {
+	pricing := &cartPricing{
+		Lines:        []cartLine{},
+		TaxBreakdown: []taxLine{},
+	}
+
+	promotions, err := loadActivePromotions(tx)
+	if err != nil {
+		return nil, err
+	}
+	pricing.Promotions = applyPromotions(promotions, cartItems)
+
+	// Promotions come first, the coupon applies to what they leave of each line
+	if coupon != nil {
+		couponDiscount, err := evaluateCoupon(tx, *coupon, userID, cartItems, pricing.Promotions.LineDiscounts)
+		if err != nil {
+			pricing.couponErr = err
+			pricing.CouponError = err.Error()
+		} else {
+			pricing.Coupon = couponDiscount
+		}
+	}
+
+	if address != nil && shippingMethod != nil {
+		pricing.ShippingMethod = shippingMethod
+		weight, subtotal := cartWeightAndSubtotal(cartItems)
+		shippingRate, ok := shippingRateFor(*shippingMethod, *address, weight, subtotal)
+		if ok {
+			pricing.ShippingCost = shippingRate.Price
+		} else {
+			pricing.ShippingUnavailable = true
+		}
+	}
+	if pricing.Coupon != nil && pricing.Coupon.FreeShipping {
+		pricing.ShippingCost = 0
+	}
+
+	var taxRules []models.TaxRule
+	taxAddress := models.Address{}
+	if address != nil {
+		taxAddress = *address
+		taxRules, err = loadTaxRules(tx, taxAddress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, cartItem := range cartItems {
+		lineDiscount := pricing.Promotions.LineDiscounts[cartItem.VariantID]
+		if pricing.Coupon != nil {
+			lineDiscount += pricing.Coupon.LineDiscounts[cartItem.VariantID]
+		}
+		lineDiscount = models.MinMoney(lineDiscount, cartItem.Variant.CurrentPrice.Mul(int(cartItem.Quantity)))
+
+		line := computeTaxLine(taxRules, taxAddress, cartItem, lineDiscount)
+		pricing.TaxBreakdown = append(pricing.TaxBreakdown, line)
+
+		priced := cartLine{
+			CartItemID:        cartItem.ID,
+			VariantID:         cartItem.VariantID,
+			Name:              cartItem.Variant.Name,
+			Quantity:          cartItem.Quantity,
+			UnitPrice:         cartItem.Variant.CurrentPrice,
+			LineTotal:         line.LineTotal,
+			Discount:          line.Discount,
+			TaxRate:           line.Rate,
+			Tax:               line.Tax,
+			Total:             line.LineTotal - line.Discount + line.Tax,
+			StockChanged:      cartItem.Variant.Inventory.Quantity < cartItem.Quantity,
+			AvailableQuantity: cartItem.Variant.Inventory.Quantity,
+		}
+		if cartItem.UnitPrice != 0 && cartItem.UnitPrice != cartItem.Variant.CurrentPrice {
+			previous := cartItem.UnitPrice
+			priced.PriceChanged = true
+			priced.PreviousUnitPrice = &previous
+		}
+		pricing.Lines = append(pricing.Lines, priced)
+
+		pricing.Subtotal += line.LineTotal
+		pricing.DiscountTotal += line.Discount
+		pricing.TaxTotal += line.Tax
+	}
+	pricing.Total = pricing.Subtotal - pricing.DiscountTotal + pricing.TaxTotal + pricing.ShippingCost
+
+	return pricing, nil
+}
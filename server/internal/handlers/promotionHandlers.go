@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// appliedPromotion is what one promotion took off a cart
+type appliedPromotion struct {
+	PromotionID uint         `json:"promotionID"`
+	Name        string       `json:"name"`
+	Discount    models.Money `json:"discount"`
+}
+
+// promotionResult is what the running promotions take off a cart
+type promotionResult struct {
+	Applied  []appliedPromotion `json:"applied"`
+	Discount models.Money       `json:"discount"`
+	// LineDiscounts holds the discount of every promoted line keyed by variant ID
+	LineDiscounts map[uint]models.Money `json:"lineDiscounts"`
+}
+
+// promotionPayload is the admin representation of a promotion with its variants as IDs
+type promotionPayload struct {
+	models.Promotion
+	VariantIDs []uint `json:"variantIDs"`
+}
+
+// promotionUnit is a single unit of a cart line, buy X get Y works unit by unit
+type promotionUnit struct {
+	VariantID uint
+	Price     models.Money
+}
+
+// loadActivePromotions fetches the promotions running right now with their variants
+func loadActivePromotions(tx *gorm.DB) ([]models.Promotion, error) {
+	now := time.Now()
+
+	var promotions []models.Promotion
+	result := tx.Preload("Variants").
+		Where("active = ?", true).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Order("id ASC").Find(&promotions)
+	return promotions, result.Error
+}
+
+// loadVariantPromotions fetches the running promotions that include one of the variants, with their variants
+func loadVariantPromotions(tx *gorm.DB, variantIDs []uint) ([]models.Promotion, error) {
+	if len(variantIDs) == 0 {
+		return []models.Promotion{}, nil
+	}
+	now := time.Now()
+
+	var promotions []models.Promotion
+	result := tx.Preload("Variants").
+		Where("id IN (SELECT promotion_id FROM promotion_variants WHERE variant_id IN ?)", variantIDs).
+		Where("active = ?", true).
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now).
+		Order("id ASC").Find(&promotions)
+	return promotions, result.Error
+}
+
+// promotionsByProduct groups promotions under the products whose variants they include, every
+// product has an entry so a listing can tell a product without promotions apart
+func promotionsByProduct(products []models.Product, promotions []models.Promotion) map[uint][]models.Promotion {
+	productOfVariant := make(map[uint]uint)
+	grouped := make(map[uint][]models.Promotion, len(products))
+	for _, product := range products {
+		grouped[product.ID] = []models.Promotion{}
+		for _, variant := range product.Variants {
+			productOfVariant[variant.ID] = product.ID
+		}
+	}
+
+	for _, promotion := range promotions {
+		added := make(map[uint]bool)
+		for _, variant := range promotion.Variants {
+			productID, ok := productOfVariant[variant.ID]
+			if !ok || added[productID] {
+				continue
+			}
+			added[productID] = true
+			grouped[productID] = append(grouped[productID], promotion)
+		}
+	}
+	return grouped
+}
+
+// applyPromotions computes the automatic discounts of a cart.
+// Promotions are applied oldest first and a unit counts towards a single promotion, so they never stack.
+func applyPromotions(promotions []models.Promotion, cartItems []models.CartItem) promotionResult {
+	promotionResult := promotionResult{
+		LineDiscounts: make(map[uint]models.Money),
+	}
+
+	prices := make(map[uint]models.Money)
+	available := make(map[uint]int)
+	for _, cartItem := range cartItems {
+		prices[cartItem.VariantID] = cartItem.Variant.CurrentPrice
+		available[cartItem.VariantID] += int(cartItem.Quantity)
+	}
+
+	for _, promotion := range promotions {
+		lineDiscounts := make(map[uint]models.Money)
+
+		switch promotion.Type {
+		case models.PromotionTypeBuyXGetY:
+			groupSize := promotion.BuyQuantity + promotion.GetQuantity
+			if promotion.GetQuantity <= 0 || groupSize <= 0 {
+				continue
+			}
+
+			var units []promotionUnit
+			for _, variant := range promotion.Variants {
+				for i := 0; i < available[variant.ID]; i++ {
+					units = append(units, promotionUnit{VariantID: variant.ID, Price: prices[variant.ID]})
+				}
+			}
+			groups := len(units) / groupSize
+			if groups == 0 {
+				continue
+			}
+
+			// Most expensive units fill the groups, the cheapest of them are the discounted ones
+			sort.SliceStable(units, func(i, j int) bool { return units[i].Price > units[j].Price })
+			units = units[:groups*groupSize]
+			for i, unit := range units {
+				available[unit.VariantID]--
+				if i >= len(units)-groups*promotion.GetQuantity {
+					lineDiscounts[unit.VariantID] += unit.Price.Percent(promotion.DiscountPercent)
+				}
+			}
+		case models.PromotionTypeBundle:
+			if len(promotion.Variants) == 0 {
+				continue
+			}
+
+			sets := -1
+			for _, variant := range promotion.Variants {
+				if sets == -1 || available[variant.ID] < sets {
+					sets = available[variant.ID]
+				}
+			}
+			if sets <= 0 {
+				continue
+			}
+
+			for _, variant := range promotion.Variants {
+				available[variant.ID] -= sets
+				lineDiscounts[variant.ID] += prices[variant.ID].Mul(sets).Percent(promotion.DiscountPercent)
+			}
+		}
+
+		var discount models.Money
+		for variantID, lineDiscount := range lineDiscounts {
+			promotionResult.LineDiscounts[variantID] += lineDiscount
+			discount += lineDiscount
+		}
+		if discount <= 0 {
+			continue
+		}
+
+		promotionResult.Applied = append(promotionResult.Applied, appliedPromotion{
+			PromotionID: promotion.ID,
+			Name:        promotion.Name,
+			Discount:    discount,
+		})
+		promotionResult.Discount += discount
+	}
+	return promotionResult
+}
+
+// validatePromotion checks the fields of a promotion payload
+func validatePromotion(payload promotionPayload) error {
+	if payload.Name == "" {
+		return errors.New("promotion name is required")
+	}
+	if !payload.Type.IsValid() {
+		return errors.New("invalid promotion type")
+	}
+	if payload.DiscountPercent <= 0 || payload.DiscountPercent > 100 {
+		return errors.New("discount percent has to be between 0 and 100")
+	}
+	if payload.Type == models.PromotionTypeBuyXGetY && (payload.BuyQuantity <= 0 || payload.GetQuantity <= 0) {
+		return errors.New("buy x get y promotions need positive buy and get quantities")
+	}
+	if payload.Type == models.PromotionTypeBundle && len(payload.VariantIDs) < 2 {
+		return errors.New("a bundle needs at least two variants")
+	}
+	if len(payload.VariantIDs) == 0 {
+		return errors.New("a promotion needs at least one variant")
+	}
+	if payload.StartsAt != nil && payload.EndsAt != nil && !payload.EndsAt.After(*payload.StartsAt) {
+		return errors.New("promotion ends before it starts")
+	}
+	return nil
+}
+
+// replacePromotionVariants sets the variants a promotion applies to
+func replacePromotionVariants(tx *gorm.DB, promotion *models.Promotion, variantIDs []uint) error {
+	var variants []models.Variant
+	if err := tx.Where("id IN ?", variantIDs).Find(&variants).Error; err != nil {
+		return err
+	}
+	if len(variants) != len(variantIDs) {
+		return errors.New("some variants of the promotion don't exist")
+	}
+	return tx.Model(promotion).Association("Variants").Replace(variants)
+}
+
+// ======================
+// Promotion Management
+// ======================
+
+func (h *AdminHandler) GetPromotions(w http.ResponseWriter, r *http.Request) {
+	var promotions []models.Promotion
+	result := db.DB.DB.Preload("Variants").Order("created_at DESC").Find(&promotions)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting promotions, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":    "Successfully fetched results",
+		"promotions": promotions,
+	})
+}
+
+func (h *AdminHandler) PostPromotion(w http.ResponseWriter, r *http.Request) {
+	var payload promotionPayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validatePromotion(payload); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	promotion := payload.Promotion
+	promotion.ID = 0
+	promotion.Variants = nil
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result := tx.Create(&promotion)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	if err := replacePromotionVariants(tx, &promotion, payload.VariantIDs); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	db.DB.DB.Preload("Variants").First(&promotion, promotion.ID)
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":   "Promotion created successfully",
+		"promotion": promotion,
+	})
+}
+
+func (h *AdminHandler) PutPromotion(w http.ResponseWriter, r *http.Request) {
+	var payload promotionPayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("promotion ID is required"))
+		return
+	}
+
+	if err := validatePromotion(payload); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var promotion models.Promotion
+	result := tx.First(&promotion, payload.ID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("promotion not found: %w", result.Error))
+		return
+	}
+
+	promotion.Name = payload.Name
+	promotion.Description = payload.Description
+	promotion.Type = payload.Type
+	promotion.BuyQuantity = payload.BuyQuantity
+	promotion.GetQuantity = payload.GetQuantity
+	promotion.DiscountPercent = payload.DiscountPercent
+	promotion.StartsAt = payload.StartsAt
+	promotion.EndsAt = payload.EndsAt
+	promotion.Active = payload.Active
+
+	result = tx.Omit("Variants").Save(&promotion)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	if err := replacePromotionVariants(tx, &promotion, payload.VariantIDs); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	db.DB.DB.Preload("Variants").First(&promotion, promotion.ID)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":   "Promotion updated successfully",
+		"promotion": promotion,
+	})
+}
+
+func (h *AdminHandler) DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	promotionID := vars["promotionID"]
+
+	if promotionID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("promotion id is missing in the url"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var promotion models.Promotion
+	result := tx.First(&promotion, promotionID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("promotion not found: %w", result.Error))
+		return
+	}
+
+	if err := tx.Model(&promotion).Association("Variants").Clear(); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result = tx.Delete(&promotion)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Promotion was deleted.",
+	})
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+func TestPromotionsByProduct(t *testing.T) {
+	variant := func(id uint) models.Variant {
+		v := models.Variant{}
+		v.ID = id
+		return v
+	}
+	product := func(id uint, variants ...models.Variant) models.Product {
+		p := models.Product{Variants: variants}
+		p.ID = id
+		return p
+	}
+	promotion := func(id uint, variants ...models.Variant) models.Promotion {
+		p := models.Promotion{Variants: variants}
+		p.ID = id
+		return p
+	}
+
+	products := []models.Product{
+		product(1, variant(10), variant(11)),
+		product(2, variant(20)),
+		product(3, variant(30)),
+	}
+	promotions := []models.Promotion{
+		promotion(100, variant(10), variant(11)),
+		promotion(101, variant(11), variant(20), variant(99)),
+	}
+
+	grouped := promotionsByProduct(products, promotions)
+
+	want := map[uint][]uint{1: {100, 101}, 2: {101}, 3: {}}
+	if len(grouped) != len(want) {
+		t.Fatalf("promotionsByProduct() has %d products, want %d", len(grouped), len(want))
+	}
+	for productID, wantIDs := range want {
+		got := grouped[productID]
+		if got == nil || len(got) != len(wantIDs) {
+			t.Errorf("product %d has %d promotions, want %v", productID, len(got), wantIDs)
+			continue
+		}
+		for i, id := range wantIDs {
+			if got[i].ID != id {
+				t.Errorf("product %d promotion %d = %d, want %d", productID, i, got[i].ID, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/auth"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errBuiltInRole       = errors.New("the admin role is built in and can't be changed")
+	errLastAdmin         = errors.New("the last admin can't lose the admin role")
+	errUnknownPermission = errors.New("unknown permission")
+	errStaffAccount      = errors.New("only users who can manage roles can act on a user holding a role")
+	errOutranked         = errors.New("you can't act on a user holding permissions you don't have")
+	errGrantOutranked    = errors.New("you can't hand out permissions you don't have")
+	errInvalidUserID     = errors.New("invalid user id")
+)
+
+// rolePayload is a role as sent by the admin panel, permissions are given by name
+type rolePayload struct {
+	ID          uint     `json:"ID"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// loadPermissions looks up permissions by name and fails on names outside the catalog
+func loadPermissions(tx *gorm.DB, names []string) ([]models.Permission, error) {
+	for _, name := range names {
+		if !models.IsKnownPermission(name) {
+			return nil, fmt.Errorf("%w %q", errUnknownPermission, name)
+		}
+	}
+
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	if result := tx.Where("name IN ?", names).Find(&permissions); result.Error != nil {
+		return nil, result.Error
+	}
+	return permissions, nil
+}
+
+// holdsAll reports whether every wanted permission is among the granted ones
+func holdsAll(granted []string, wanted []string) bool {
+	held := make(map[string]bool)
+	for _, permission := range granted {
+		held[permission] = true
+	}
+	for _, permission := range wanted {
+		if !held[permission] {
+			return false
+		}
+	}
+	return true
+}
+
+// canManageUser decides whether someone may edit, log out or delete another user. A user holding a role
+// is only handled by role managers and never by someone with fewer permissions, otherwise changing their
+// email and resetting the password would hand over their access.
+func canManageUser(actorPermissions []string, targetRoles int64, targetPermissions []string) error {
+	if targetRoles > 0 && !holdsAll(actorPermissions, []string{models.PermissionRolesManage}) {
+		return errStaffAccount
+	}
+	if !holdsAll(actorPermissions, targetPermissions) {
+		return errOutranked
+	}
+	return nil
+}
+
+// checkCanManageUser loads what both users hold and applies canManageUser
+func checkCanManageUser(actorID uint, targetID uint) error {
+	if actorID == targetID {
+		return nil
+	}
+
+	actorPermissions, err := auth.UserPermissions(actorID)
+	if err != nil {
+		return err
+	}
+	targetPermissions, err := auth.UserPermissions(targetID)
+	if err != nil {
+		return err
+	}
+
+	var targetRoles int64
+	if err := db.DB.DB.Table("user_roles").Where("user_id = ?", targetID).Count(&targetRoles).Error; err != nil {
+		return err
+	}
+
+	return canManageUser(actorPermissions, targetRoles, targetPermissions)
+}
+
+// checkCanManageTargetUser applies checkCanManageUser to the logged in user and the user ID taken from the url
+func checkCanManageTargetUser(r *http.Request, targetID string) error {
+	actorID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		return errStaffAccount
+	}
+	id, err := strconv.ParseUint(targetID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w %q", errInvalidUserID, targetID)
+	}
+	return checkCanManageUser(uint(actorID), uint(id))
+}
+
+// checkCanGrant makes sure the logged in user holds every permission they are about to hand out through a role
+func checkCanGrant(r *http.Request, permissions []string) error {
+	actorID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		return errGrantOutranked
+	}
+	actorPermissions, err := auth.UserPermissions(uint(actorID))
+	if err != nil {
+		return err
+	}
+	if !holdsAll(actorPermissions, permissions) {
+		return errGrantOutranked
+	}
+	return nil
+}
+
+// writeManageUserError answers a request turned down by the user or role checks
+func writeManageUserError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errStaffAccount) || errors.Is(err, errOutranked) || errors.Is(err, errGrantOutranked) {
+		utils.WriteError(w, http.StatusForbidden, err)
+		return
+	}
+	if errors.Is(err, errInvalidUserID) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with checking permissions, try again"))
+}
+
+// rolePermissionNames lists the names of the permissions a role grants
+func rolePermissionNames(tx *gorm.DB, roleID uint) ([]string, error) {
+	var names []string
+	result := tx.Table("role_permissions").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("role_permissions.role_id = ?", roleID).
+		Pluck("permissions.name", &names)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return names, nil
+}
+
+// checkCanHandleRole makes sure the logged in user holds everything the role grants before changing who has it
+func checkCanHandleRole(r *http.Request, roleID uint) error {
+	permissions, err := rolePermissionNames(db.DB.DB, roleID)
+	if err != nil {
+		return err
+	}
+	return checkCanGrant(r, permissions)
+}
+
+// ======================
+// Role Management
+// ======================
+
+func (h *AdminHandler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	var permissions []models.Permission
+	result := db.DB.DB.Order("name ASC").Find(&permissions)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting permissions, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":     "Successfully fetched results",
+		"permissions": permissions,
+	})
+}
+
+func (h *AdminHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	var roles []models.Role
+	result := db.DB.DB.Preload("Permissions").Order("name ASC").Find(&roles)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting roles, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Successfully fetched results",
+		"roles":   roles,
+	})
+}
+
+func (h *AdminHandler) PostRole(w http.ResponseWriter, r *http.Request) {
+	var payload rolePayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("role name is required"))
+		return
+	}
+
+	var existing int64
+	db.DB.DB.Model(&models.Role{}).Where("name = ?", payload.Name).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, errors.New("a role with this name already exists"))
+		return
+	}
+
+	if err := checkCanGrant(r, payload.Permissions); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
+	permissions, err := loadPermissions(db.DB.DB, payload.Permissions)
+	if err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	role := models.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Permissions: permissions,
+	}
+	result := db.DB.DB.Create(&role)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message": "Role created successfully",
+		"role":    role,
+	})
+}
+
+func (h *AdminHandler) PutRole(w http.ResponseWriter, r *http.Request) {
+	var payload rolePayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("role ID is required"))
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("role name is required"))
+		return
+	}
+
+	var role models.Role
+	result := db.DB.DB.First(&role, payload.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("role not found: %w", result.Error))
+		return
+	}
+	if role.Name == models.RoleAdmin {
+		utils.WriteError(w, http.StatusConflict, errBuiltInRole)
+		return
+	}
+
+	if err := checkCanHandleRole(r, role.ID); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+	if err := checkCanGrant(r, payload.Permissions); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
+	var existing int64
+	db.DB.DB.Model(&models.Role{}).Where("name = ? AND id <> ?", payload.Name, role.ID).Count(&existing)
+	if existing > 0 {
+		utils.WriteError(w, http.StatusConflict, errors.New("a role with this name already exists"))
+		return
+	}
+
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		permissions, err := loadPermissions(tx, payload.Permissions)
+		if err != nil {
+			return err
+		}
+
+		role.Name = payload.Name
+		role.Description = payload.Description
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		return tx.Model(&role).Association("Permissions").Replace(permissions)
+	})
+	if err != nil {
+		if errors.Is(err, errUnknownPermission) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	db.DB.DB.Preload("Permissions").First(&role, role.ID)
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Role updated successfully",
+		"role":    role,
+	})
+}
+
+func (h *AdminHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	roleID := vars["roleID"]
+
+	if roleID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("role id is missing in the url"))
+		return
+	}
+
+	var role models.Role
+	result := db.DB.DB.First(&role, roleID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("role not found: %w", result.Error))
+		return
+	}
+	if role.Name == models.RoleAdmin {
+		utils.WriteError(w, http.StatusConflict, errBuiltInRole)
+		return
+	}
+	if err := checkCanHandleRole(r, role.ID); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		// Role names are unique, a hard delete frees the name
+		return tx.Unscoped().Delete(&role).Error
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Role was deleted.",
+	})
+}
+
+// PostUserRole gives a user a role
+func (h *AdminHandler) PostUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var payload struct {
+		RoleID uint `json:"roleID"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var user models.User
+	result := db.DB.DB.Select("id").First(&user, vars["userID"])
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("user not found"))
+		return
+	}
+
+	var role models.Role
+	result = db.DB.DB.First(&role, payload.RoleID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("role not found"))
+		return
+	}
+
+	// Handing out a role can't grant more than the caller has, and staff are only changed by their peers
+	if err := checkCanHandleRole(r, role.ID); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+	if err := checkCanManageTargetUser(r, vars["userID"]); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
+	if err := db.DB.DB.Model(&user).Association("Roles").Append(&role); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with assigning the role, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Role assigned",
+	})
+}
+
+// DeleteUserRole takes a role away from a user, the last admin can't lose the admin role
+func (h *AdminHandler) DeleteUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var role models.Role
+	result := db.DB.DB.First(&role, vars["roleID"])
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, errors.New("role not found"))
+		return
+	}
+
+	if err := checkCanHandleRole(r, role.ID); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+	if err := checkCanManageTargetUser(r, vars["userID"]); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?", vars["userID"], role.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if role.Name == models.RoleAdmin {
+			var admins int64
+			if err := tx.Table("user_roles").Where("role_id = ?", role.ID).Count(&admins).Error; err != nil {
+				return err
+			}
+			if admins == 0 {
+				return errLastAdmin
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("the user doesn't have this role"))
+			return
+		}
+		if errors.Is(err, errLastAdmin) {
+			utils.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with removing the role, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Role removed",
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+func TestCanManageUser(t *testing.T) {
+	admin := make([]string, 0, len(models.PermissionCatalog))
+	for _, permission := range models.PermissionCatalog {
+		admin = append(admin, permission.Name)
+	}
+	userManager := []string{models.PermissionUsersRead, models.PermissionUsersManage}
+	roleManager := []string{models.PermissionUsersManage, models.PermissionRolesManage, models.PermissionOrdersRead}
+
+	tests := []struct {
+		name              string
+		actorPermissions  []string
+		targetRoles       int64
+		targetPermissions []string
+		want              error
+	}{
+		{"user manager edits a customer", userManager, 0, nil, nil},
+		{"user manager can't edit an admin", userManager, 1, admin, errStaffAccount},
+		{"user manager can't edit a role without permissions", userManager, 1, nil, errStaffAccount},
+		{"role manager can't edit an admin", roleManager, 1, admin, errOutranked},
+		{"role manager edits a user with fewer permissions", roleManager, 1, []string{models.PermissionOrdersRead}, nil},
+		{"role manager can't edit warehouse staff", roleManager, 1, models.WarehousePermissions, errOutranked},
+		{"admin edits another admin", admin, 1, admin, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := canManageUser(tt.actorPermissions, tt.targetRoles, tt.targetPermissions)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("canManageUser() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHoldsAll(t *testing.T) {
+	granted := []string{models.PermissionRolesManage, models.PermissionOrdersRead}
+
+	tests := []struct {
+		name   string
+		wanted []string
+		want   bool
+	}{
+		{"nothing wanted", nil, true},
+		{"subset", []string{models.PermissionOrdersRead}, true},
+		{"same set", []string{models.PermissionOrdersRead, models.PermissionRolesManage}, true},
+		{"one missing", []string{models.PermissionOrdersRead, models.PermissionOrdersRefund}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := holdsAll(granted, tt.wanted); got != tt.want {
+				t.Errorf("holdsAll(%v) = %t, want %t", tt.wanted, got, tt.want)
+			}
+		})
+	}
+}
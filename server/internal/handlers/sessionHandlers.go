@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// sessionView is a session as listed to its user, Current marks the one making the request
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// GetSessions lists the devices the user is logged in on
+func (h *UserHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+	currentSessionID, _ := r.Context().Value("sessionID").(uint)
+
+	var sessions []models.Session
+	result := db.DB.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting sessions, try again"))
+		return
+	}
+
+	views := make([]sessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, sessionView{
+			Session: session,
+			Current: session.ID == currentSessionID,
+		})
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Successfully fetched results",
+		"sessions": views,
+	})
+}
+
+// DeleteSession logs one of the user's devices out
+func (h *UserHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	sessionID := mux.Vars(r)["sessionID"]
+
+	var revoked int64
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = revokeSessions(tx, "id = ? AND user_id = ?", sessionID, userID)
+		return err
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with revoking the session, try again"))
+		return
+	}
+	if revoked == 0 {
+		utils.WriteError(w, http.StatusNotFound, errors.New("session not found"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Session was revoked.",
+	})
+}
+
+// DeleteSessions logs the user out everywhere, including the device making the request
+func (h *UserHandler) DeleteSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var revoked int64
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = revokeSessions(tx, "user_id = ?", userID)
+		return err
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with revoking sessions, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "All sessions were revoked.",
+		"revoked": revoked,
+	})
+}
+
+// ======================
+// Session Management
+// ======================
+
+// DeleteUserSessions logs a user out everywhere, for example after taking away their admin rights
+func (h *AdminHandler) DeleteUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userID"]
+	if userID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("user id is missing in the url"))
+		return
+	}
+
+	if err := checkCanManageTargetUser(r, userID); err != nil {
+		writeManageUserError(w, err)
+		return
+	}
+
+	var revoked int64
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = revokeSessions(tx, "user_id = ?", userID)
+		return err
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with revoking sessions, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "User sessions were revoked.",
+		"revoked": revoked,
+	})
+}
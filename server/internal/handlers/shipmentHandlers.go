@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// shipmentEventPayload is the tracking event sent by admins and carriers
+type shipmentEventPayload struct {
+	Status      models.ShipmentStatus `json:"status"`
+	Location    string                `json:"location"`
+	Description string                `json:"description"`
+	OccurredAt  *time.Time            `json:"occurredAt"`
+}
+
+// appendShipmentEvent adds a tracking event to the shipment and updates the shipment and its order.
+// A delivered shipment moves the order to Delivered when the order allows it.
+func appendShipmentEvent(tx *gorm.DB, shipment *models.Shipment, event models.ShipmentEvent) error {
+	event.ShipmentID = shipment.ID
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	result := tx.Create(&event)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// Events can arrive out of order, only the latest one decides the shipment status
+	var latest models.ShipmentEvent
+	result = tx.Where("shipment_id = ?", shipment.ID).Order("occurred_at DESC, id DESC").First(&latest)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	updates := map[string]interface{}{
+		"status": latest.Status,
+	}
+	if event.Status == models.ShipmentStatusDelivered && shipment.DeliveredAt == nil {
+		updates["delivered_at"] = event.OccurredAt
+	}
+	result = tx.Model(shipment).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if event.Status != models.ShipmentStatusDelivered {
+		return nil
+	}
+
+	var order models.Order
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, shipment.OrderID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if !order.Status.CanTransitionTo(models.OrderStatusDelivered) {
+		return nil
+	}
+
+	return changeOrderStatus(tx, &order, models.OrderStatusDelivered, nil, "Delivered by "+shipment.Carrier)
+}
+
+// GetOrderTracking returns the shipments of the user's order with their tracking timeline
+func (h *UserHandler) GetOrderTracking(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var order models.Order
+	result := db.DB.DB.Preload("Shipments").Preload("Shipments.Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("occurred_at")
+	}).Where("id = ? AND user_id = ?", orderID, userID).First(&order)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting the tracking, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":     "Fetched tracking",
+		"orderStatus": order.Status,
+		"shipments":   order.Shipments,
+	})
+}
+
+// ======================
+// Shipment Management
+// ======================
+
+// PostShipment hands an order over to a carrier and marks it as shipped
+func (h *AdminHandler) PostShipment(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("unauthorized access"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	orderID := vars["orderID"]
+
+	var payload struct {
+		Carrier        string `json:"carrier"`
+		TrackingNumber string `json:"trackingNumber"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	payload.Carrier = strings.TrimSpace(payload.Carrier)
+	payload.TrackingNumber = strings.TrimSpace(payload.TrackingNumber)
+	if payload.Carrier == "" || payload.TrackingNumber == "" {
+		utils.WriteError(w, http.StatusConflict, errors.New("carrier and tracking number are required"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var order models.Order
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("order not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the shipment, try again"))
+		return
+	}
+
+	if order.Status != models.OrderStatusPaid && order.Status != models.OrderStatusProcessing {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("a %s order can't be shipped", order.Status))
+		return
+	}
+
+	shippedBy := uint(adminID)
+	if order.Status == models.OrderStatusPaid {
+		if err := changeOrderStatus(tx, &order, models.OrderStatusProcessing, &shippedBy, ""); err != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the shipment, try again"))
+			return
+		}
+	}
+
+	now := time.Now()
+	shipment := models.Shipment{
+		OrderID:        order.ID,
+		Carrier:        payload.Carrier,
+		TrackingNumber: payload.TrackingNumber,
+		Status:         models.ShipmentStatusLabelCreated,
+		ShippedAt:      &now,
+	}
+	result = tx.Create(&shipment)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the shipment, try again"))
+		return
+	}
+
+	if err := appendShipmentEvent(tx, &shipment, models.ShipmentEvent{
+		Status:      models.ShipmentStatusLabelCreated,
+		Description: "Shipment created",
+		OccurredAt:  now,
+	}); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the shipment, try again"))
+		return
+	}
+
+	if err := changeOrderStatus(tx, &order, models.OrderStatusShipped, &shippedBy, "Shipped with "+shipment.Carrier); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the shipment, try again"))
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	var createdShipment models.Shipment
+	result = db.DB.DB.Preload("Events").First(&createdShipment, shipment.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":  "Shipment created successfully",
+		"shipment": createdShipment,
+	})
+}
+
+// PostShipmentEvent appends a tracking event entered by an admin
+func (h *AdminHandler) PostShipmentEvent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shipmentID := vars["shipmentID"]
+
+	var payload shipmentEventPayload
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if !payload.Status.IsValid() {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("invalid shipment status"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var shipment models.Shipment
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&shipment, shipmentID)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("shipment not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with adding the tracking event, try again"))
+		return
+	}
+
+	event := models.ShipmentEvent{
+		Status:      payload.Status,
+		Location:    payload.Location,
+		Description: payload.Description,
+	}
+	if payload.OccurredAt != nil {
+		event.OccurredAt = *payload.OccurredAt
+	}
+
+	if err := appendShipmentEvent(tx, &shipment, event); err != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with adding the tracking event, try again"))
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	var updatedShipment models.Shipment
+	result = db.DB.DB.Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("occurred_at")
+	}).First(&updatedShipment, shipment.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":  "Tracking event added",
+		"shipment": updatedShipment,
+	})
+}
+
+// PostCarrierWebhook receives tracking updates pushed by carriers, it is disabled until a secret is configured.
+// Requests are signed with an HMAC of the body and events are deduplicated by their carrier ID.
+func (h *WebhookHandler) PostCarrierWebhook(w http.ResponseWriter, r *http.Request) {
+	if config.Envs.CarrierWebhookSecret == "" {
+		utils.WriteError(w, http.StatusNotFound, errors.New("carrier webhook is disabled"))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("unable to read webhook body"))
+		return
+	}
+
+	if !utils.VerifySignature(body, r.Header.Get("X-Carrier-Signature"), config.Envs.CarrierWebhookSecret) {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("webhook signature is invalid"))
+		return
+	}
+
+	var payload struct {
+		shipmentEventPayload
+		EventID        string `json:"eventID"`
+		Carrier        string `json:"carrier"`
+		TrackingNumber string `json:"trackingNumber"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.EventID == "" || payload.TrackingNumber == "" || !payload.Status.IsValid() {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("event ID, tracking number and a valid status are required"))
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var existing int64
+	result := tx.Model(&models.ShipmentEvent{}).Where("carrier_event_id = ?", payload.EventID).Count(&existing)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+	if existing > 0 {
+		tx.Rollback()
+		utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "Event already processed",
+		})
+		return
+	}
+
+	var shipment models.Shipment
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("tracking_number = ? AND LOWER(carrier) = LOWER(?)", payload.TrackingNumber, payload.Carrier).
+		First(&shipment)
+	if result.Error != nil {
+		tx.Rollback()
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			log.Printf("carrier event %s references unknown tracking number %s", payload.EventID, payload.TrackingNumber)
+			utils.WriteError(w, http.StatusNotFound, errors.New("shipment not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	event := models.ShipmentEvent{
+		Status:         payload.Status,
+		Location:       payload.Location,
+		Description:    payload.Description,
+		CarrierEventID: &payload.EventID,
+	}
+	if payload.OccurredAt != nil {
+		event.OccurredAt = *payload.OccurredAt
+	}
+
+	if err := appendShipmentEvent(tx, &shipment, event); err != nil {
+		tx.Rollback()
+		log.Printf("carrier event %s could not be applied: %v", payload.EventID, err)
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("event could not be processed"))
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Event processed",
+	})
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// shippingQuote is the price of one shipping method for a cart and destination
+type shippingQuote struct {
+	ShippingMethod models.ShippingMethod `json:"shippingMethod"`
+	Cost           models.Money          `json:"cost"`
+}
+
+// cartWeightAndSubtotal sums the weight and the price of the cart items
+func cartWeightAndSubtotal(cartItems []models.CartItem) (float64, models.Money) {
+	var weight float64
+	var subtotal models.Money
+	for _, cartItem := range cartItems {
+		weight += cartItem.Variant.Weight * float64(cartItem.Quantity)
+		subtotal += cartItem.Variant.CurrentPrice.Mul(int(cartItem.Quantity))
+	}
+	return weight, subtotal
+}
+
+// shippingRateFor picks the rate of the method that applies to the destination, weight and subtotal.
+// Rates for the exact state win over country wide rates which win over catch-all rates, ties go to the cheapest.
+func shippingRateFor(method models.ShippingMethod, address models.Address, weight float64, subtotal models.Money) (*models.ShippingRate, bool) {
+	var best *models.ShippingRate
+	bestSpecificity := -1
+
+	for i := range method.Rates {
+		rate := &method.Rates[i]
+
+		specificity := 0
+		if rate.Country != "" {
+			if !strings.EqualFold(strings.TrimSpace(rate.Country), strings.TrimSpace(address.Country)) {
+				continue
+			}
+			specificity++
+		}
+		if rate.State != "" {
+			if !strings.EqualFold(strings.TrimSpace(rate.State), strings.TrimSpace(address.State)) {
+				continue
+			}
+			specificity++
+		}
+
+		if weight < rate.MinWeight || (rate.MaxWeight > 0 && weight > rate.MaxWeight) {
+			continue
+		}
+		if subtotal < rate.MinSubtotal || (rate.MaxSubtotal > 0 && subtotal > rate.MaxSubtotal) {
+			continue
+		}
+
+		if specificity > bestSpecificity || (specificity == bestSpecificity && rate.Price < best.Price) {
+			best = rate
+			bestSpecificity = specificity
+		}
+	}
+
+	return best, best != nil
+}
+
+// cheapestShippingMethod picks the method that delivers the cart to the address for the lowest price
+func cheapestShippingMethod(methods []models.ShippingMethod, address models.Address, cartItems []models.CartItem) *models.ShippingMethod {
+	weight, subtotal := cartWeightAndSubtotal(cartItems)
+
+	var cheapest *models.ShippingMethod
+	var cheapestPrice models.Money
+	for i := range methods {
+		rate, ok := shippingRateFor(methods[i], address, weight, subtotal)
+		if !ok {
+			continue
+		}
+		if cheapest == nil || rate.Price < cheapestPrice {
+			cheapest = &methods[i]
+			cheapestPrice = rate.Price
+		}
+	}
+	return cheapest
+}
+
+// validateShippingMethod checks the fields of a shipping method payload and its rates
+func validateShippingMethod(method models.ShippingMethod) error {
+	if strings.TrimSpace(method.Name) == "" {
+		return errors.New("shipping method name is required")
+	}
+	if len(method.Rates) == 0 {
+		return errors.New("shipping method needs at least one rate")
+	}
+
+	for i, rate := range method.Rates {
+		if rate.Price < 0 {
+			return fmt.Errorf("rate %d has a negative price", i+1)
+		}
+		if rate.MaxWeight > 0 && rate.MaxWeight < rate.MinWeight {
+			return fmt.Errorf("rate %d has a max weight below its min weight", i+1)
+		}
+		if rate.MaxSubtotal > 0 && rate.MaxSubtotal < rate.MinSubtotal {
+			return fmt.Errorf("rate %d has a max subtotal below its min subtotal", i+1)
+		}
+	}
+
+	return nil
+}
+
+// GetShippingQuote prices every active shipping method that can deliver the cart to one of the user's addresses
+func (h *UserHandler) GetShippingQuote(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	addressID := r.URL.Query().Get("addressID")
+	if addressID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("address ID is required"))
+		return
+	}
+
+	var address models.Address
+	result := db.DB.DB.Where("id = ? AND user_id = ?", addressID, userID).First(&address)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("address not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with quoting shipping, try again"))
+		return
+	}
+
+	var cartItems []models.CartItem
+	result = db.DB.DB.Preload("Variant").Where("user_id = ?", userID).Find(&cartItems)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with quoting shipping, try again"))
+		return
+	}
+
+	var methods []models.ShippingMethod
+	result = db.DB.DB.Preload("Rates").Where("active = ?", true).Find(&methods)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with quoting shipping, try again"))
+		return
+	}
+
+	weight, subtotal := cartWeightAndSubtotal(cartItems)
+
+	quotes := []shippingQuote{}
+	for _, method := range methods {
+		rate, ok := shippingRateFor(method, address, weight, subtotal)
+		if !ok {
+			continue
+		}
+		quotes = append(quotes, shippingQuote{
+			ShippingMethod: method,
+			Cost:           rate.Price,
+		})
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Fetched shipping quotes",
+		"weight":  weight,
+		"quotes":  quotes,
+	})
+}
+
+// ======================
+// Shipping Management
+// ======================
+
+func (h *AdminHandler) GetShippingMethods(w http.ResponseWriter, r *http.Request) {
+	var methods []models.ShippingMethod
+	result := db.DB.DB.Preload("Rates").Order("id").Find(&methods)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting shipping methods, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":         "Successfully fetched results",
+		"shippingMethods": methods,
+	})
+}
+
+func (h *AdminHandler) PostShippingMethod(w http.ResponseWriter, r *http.Request) {
+	var payload models.ShippingMethod
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateShippingMethod(payload); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	payload.ID = 0
+	for i := range payload.Rates {
+		payload.Rates[i].ID = 0
+	}
+
+	result := db.DB.DB.Create(&payload)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":        "Shipping method created successfully",
+		"shippingMethod": payload,
+	})
+}
+
+// PutShippingMethod updates a shipping method and replaces all of its rates
+func (h *AdminHandler) PutShippingMethod(w http.ResponseWriter, r *http.Request) {
+	var payload models.ShippingMethod
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("shipping method ID is required"))
+		return
+	}
+
+	if err := validateShippingMethod(payload); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var method models.ShippingMethod
+	result := tx.First(&method, payload.ID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("shipping method not found: %w", result.Error))
+		return
+	}
+
+	method.Name = payload.Name
+	method.Carrier = payload.Carrier
+	method.Description = payload.Description
+	method.Active = payload.Active
+
+	result = tx.Save(&method)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	result = tx.Delete(&models.ShippingRate{}, "shipping_method_id = ?", method.ID)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	for _, rate := range payload.Rates {
+		rate.ID = 0
+		rate.ShippingMethodID = method.ID
+		result = tx.Create(&rate)
+		if result.Error != nil {
+			tx.Rollback()
+			utils.WriteError(w, http.StatusInternalServerError, result.Error)
+			return
+		}
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	var updatedMethod models.ShippingMethod
+	result = db.DB.DB.Preload("Rates").First(&updatedMethod, method.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":        "Shipping method updated successfully",
+		"shippingMethod": updatedMethod,
+	})
+}
+
+func (h *AdminHandler) DeleteShippingMethod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shippingMethodID := vars["shippingMethodID"]
+
+	if shippingMethodID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("shipping method id is missing in the url"))
+		return
+	}
+
+	result := db.DB.DB.Where("id = ?", shippingMethodID).Delete(&models.ShippingMethod{})
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Shipping method was deleted.",
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+// taxLine is the tax charged on one cart or order line
+type taxLine struct {
+	VariantID uint         `json:"variantID"`
+	Name      string       `json:"name"`
+	Quantity  uint         `json:"quantity"`
+	LineTotal models.Money `json:"lineTotal"`
+	Discount  models.Money `json:"discount"`
+	TaxRuleID *uint        `json:"taxRuleID"`
+	TaxRule   string       `json:"taxRule"`
+	Rate      float64      `json:"rate"`
+	Tax       models.Money `json:"tax"`
+}
+
+// loadTaxRules fetches the rules that may apply to a destination
+func loadTaxRules(tx *gorm.DB, address models.Address) ([]models.TaxRule, error) {
+	var rules []models.TaxRule
+	result := tx.Where("LOWER(country) = LOWER(?)", strings.TrimSpace(address.Country)).Find(&rules)
+	return rules, result.Error
+}
+
+// taxRuleFor picks the most specific rule for a destination and category.
+// A matching state outweighs a matching category, rules for other states or categories never apply.
+func taxRuleFor(rules []models.TaxRule, address models.Address, categoryID uint) *models.TaxRule {
+	var best *models.TaxRule
+	bestSpecificity := -1
+
+	for i := range rules {
+		rule := &rules[i]
+
+		specificity := 0
+		if rule.State != "" {
+			if !strings.EqualFold(strings.TrimSpace(rule.State), strings.TrimSpace(address.State)) {
+				continue
+			}
+			specificity += 2
+		}
+		if rule.CategoryID != nil {
+			if *rule.CategoryID != categoryID {
+				continue
+			}
+			specificity++
+		}
+
+		if specificity > bestSpecificity {
+			best = rule
+			bestSpecificity = specificity
+		}
+	}
+
+	return best
+}
+
+// computeTaxLine taxes a cart item after its discount, the variant's product has to be loaded for its category
+func computeTaxLine(rules []models.TaxRule, address models.Address, cartItem models.CartItem, discount models.Money) taxLine {
+	line := taxLine{
+		VariantID: cartItem.VariantID,
+		Name:      cartItem.Variant.Name,
+		Quantity:  cartItem.Quantity,
+		LineTotal: cartItem.Variant.CurrentPrice.Mul(int(cartItem.Quantity)),
+		Discount:  discount,
+	}
+
+	rule := taxRuleFor(rules, address, cartItem.Variant.Product.CategoryID)
+	if rule == nil {
+		return line
+	}
+
+	line.TaxRuleID = &rule.ID
+	line.TaxRule = rule.Name
+	line.Rate = rule.Rate
+	line.Tax = (line.LineTotal - line.Discount).Percent(rule.Rate)
+
+	return line
+}
+
+// validateTaxRule checks the fields of a tax rule payload
+func validateTaxRule(rule models.TaxRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return errors.New("tax rule name is required")
+	}
+	if strings.TrimSpace(rule.Country) == "" {
+		return errors.New("tax rule country is required")
+	}
+	if rule.Rate < 0 || rule.Rate > 100 {
+		return fmt.Errorf("tax rate must be between 0 and 100")
+	}
+	return nil
+}
+
+// ======================
+// Tax Management
+// ======================
+
+func (h *AdminHandler) GetTaxRules(w http.ResponseWriter, r *http.Request) {
+	var rules []models.TaxRule
+	result := db.DB.DB.Preload("Category").Order("country, state, id").Find(&rules)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting tax rules, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Successfully fetched results",
+		"taxRules": rules,
+	})
+}
+
+func (h *AdminHandler) PostTaxRule(w http.ResponseWriter, r *http.Request) {
+	var payload models.TaxRule
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validateTaxRule(payload); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	payload.ID = 0
+	payload.Category = nil
+
+	result := db.DB.DB.Create(&payload)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message": "Tax rule created successfully",
+		"taxRule": payload,
+	})
+}
+
+func (h *AdminHandler) PutTaxRule(w http.ResponseWriter, r *http.Request) {
+	var payload models.TaxRule
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("tax rule ID is required"))
+		return
+	}
+
+	if err := validateTaxRule(payload); err != nil {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	}
+
+	var rule models.TaxRule
+	result := db.DB.DB.First(&rule, payload.ID)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Errorf("tax rule not found: %w", result.Error))
+		return
+	}
+
+	rule.Name = payload.Name
+	rule.Country = payload.Country
+	rule.State = payload.State
+	rule.CategoryID = payload.CategoryID
+	rule.Rate = payload.Rate
+
+	result = db.DB.DB.Save(&rule)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Tax rule updated successfully",
+		"taxRule": rule,
+	})
+}
+
+func (h *AdminHandler) DeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taxRuleID := vars["taxRuleID"]
+
+	if taxRuleID == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("tax rule id is missing in the url"))
+		return
+	}
+
+	result := db.DB.DB.Where("id = ?", taxRuleID).Delete(&models.TaxRule{})
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Tax rule was deleted.",
+	})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/auth"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+)
+
+var (
+	errRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	errRefreshTokenReused  = errors.New("refresh token was already used, log in again")
+)
+
+// loginTokens is what a successful login or refresh hands back to the client
+type loginTokens struct {
+	Token            string
+	ExpiresAt        time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+
+	refreshTokenID uint
+}
+
+// response builds the json body a login or refresh answers with
+func (t *loginTokens) response(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"message":          message,
+		"token":            t.Token,
+		"expiresAt":        t.ExpiresAt,
+		"refreshToken":     t.RefreshToken,
+		"refreshExpiresAt": t.RefreshExpiresAt,
+	}
+}
+
+// newSession starts a session for a login from the device making the request
+func newSession(r *http.Request, user models.User) (*models.Session, error) {
+	family, err := auth.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	return &models.Session{
+		UserID:    user.ID,
+		Family:    family,
+		UserAgent: userAgent,
+		IP:        clientIP(r),
+	}, nil
+}
+
+// trustedProxies are the parsed config.Envs.TrustedProxies
+var trustedProxies = parseTrustedProxies(config.Envs.TrustedProxies)
+
+// parseTrustedProxies reads addresses and CIDR ranges, a single address becomes a range of one
+func parseTrustedProxies(entries []string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Printf("Ignoring invalid trusted proxy %q", entry)
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q", entry)
+			continue
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies
+}
+
+func isTrustedProxy(ip net.IP, proxies []*net.IPNet) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the address a request came from
+func clientIP(r *http.Request) string {
+	return clientIPBehind(r, trustedProxies)
+}
+
+// clientIPBehind is the address a request came from. X-Forwarded-For is only read when the request
+// comes from one of the proxies, and then from the right since the left entries are whatever the
+// client sent: the first address that isn't one of the proxies is the client.
+func clientIPBehind(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !isTrustedProxy(remote, proxies) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil {
+			// Anything left of a malformed entry can't be trusted either
+			break
+		}
+		if !isTrustedProxy(ip, proxies) {
+			return ip.String()
+		}
+		host = ip.String()
+	}
+	return host
+}
+
+// issueLoginTokens creates an access token and a refresh token for the user and points the session at them.
+// A login passes a new session, a refresh passes the session of the token it replaces.
+func issueLoginTokens(tx *gorm.DB, user models.User, session *models.Session) (*loginTokens, error) {
+	accessToken, err := auth.CreateJWT(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRefreshToken, err := auth.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(rawRefreshToken),
+		Family:    session.Family,
+		ExpiresAt: time.Now().Add(config.Envs.RefreshTokenTTL),
+	}
+	if result := tx.Create(&refreshToken); result.Error != nil {
+		return nil, result.Error
+	}
+
+	session.TokenID = accessToken.ID
+	session.LastSeenAt = time.Now()
+	session.ExpiresAt = refreshToken.ExpiresAt
+	if result := tx.Save(session); result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &loginTokens{
+		Token:            accessToken.Token,
+		ExpiresAt:        accessToken.ExpiresAt,
+		RefreshToken:     rawRefreshToken,
+		RefreshExpiresAt: refreshToken.ExpiresAt,
+		refreshTokenID:   refreshToken.ID,
+	}, nil
+}
+
+// revokeSessions ends the live sessions matching the condition and revokes their refresh tokens
+func revokeSessions(tx *gorm.DB, query string, args ...interface{}) (int64, error) {
+	var sessions []models.Session
+	if result := tx.Where(query, args...).Where("revoked_at IS NULL").Find(&sessions); result.Error != nil {
+		return 0, result.Error
+	}
+
+	now := time.Now()
+	for _, session := range sessions {
+		if result := tx.Model(&session).Update("revoked_at", now); result.Error != nil {
+			return 0, result.Error
+		}
+		if err := revokeRefreshTokenFamily(tx, session.Family); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(sessions)), nil
+}
+
+// revokeRefreshTokenFamily revokes every live token descending from the same login
+func revokeRefreshTokenFamily(tx *gorm.DB, family string) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family = ? AND revoked_at IS NULL", family).
+		Update("revoked_at", time.Now()).Error
+}
+
+// rotateRefreshToken swaps a refresh token for a new pair of tokens. Presenting a token that was
+// already rotated means it leaked, the whole family is revoked so the thief loses access too.
+func rotateRefreshToken(tx *gorm.DB, rawRefreshToken string) (*loginTokens, error) {
+	var refreshToken models.RefreshToken
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", auth.HashToken(rawRefreshToken)).First(&refreshToken)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errRefreshTokenInvalid
+		}
+		return nil, result.Error
+	}
+
+	// A token of a revoked session is dead, reusing it isn't a sign of theft
+	var session models.Session
+	result = tx.Where("family = ? AND revoked_at IS NULL", refreshToken.Family).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errRefreshTokenInvalid
+		}
+		return nil, result.Error
+	}
+
+	if refreshToken.RevokedAt != nil {
+		if _, err := revokeSessions(tx, "id = ?", session.ID); err != nil {
+			return nil, err
+		}
+		return nil, errRefreshTokenReused
+	}
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return nil, errRefreshTokenInvalid
+	}
+
+	var user models.User
+	if result := tx.First(&user, refreshToken.UserID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errRefreshTokenInvalid
+		}
+		return nil, result.Error
+	}
+
+	tokens, err := issueLoginTokens(tx, user, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	result = tx.Model(&refreshToken).Updates(map[string]interface{}{
+		"revoked_at":     time.Now(),
+		"replaced_by_id": tokens.refreshTokenID,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return tokens, nil
+}
+
+// PostTokenRefresh trades a refresh token for a new access token and a new refresh token
+func (h *UserHandler) PostTokenRefresh(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.RefreshToken == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("refresh token is required"))
+		return
+	}
+
+	var tokens *loginTokens
+	var rotateErr error
+	err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		tokens, rotateErr = rotateRefreshToken(tx, payload.RefreshToken)
+		// The family revocation of a reused token has to stick even though the refresh fails
+		if errors.Is(rotateErr, errRefreshTokenReused) {
+			return nil
+		}
+		return rotateErr
+	})
+	if err == nil {
+		err = rotateErr
+	}
+	if err != nil {
+		if errors.Is(err, errRefreshTokenInvalid) || errors.Is(err, errRefreshTokenReused) {
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		log.Printf("failed to refresh login token: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with refreshing the token, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, tokens.response("Token refreshed"))
+}
+
+// PostLogout ends the session of the refresh token and revokes its whole family. Unknown tokens are
+// accepted silently so logging out twice isn't an error.
+func (h *UserHandler) PostLogout(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.RefreshToken == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("refresh token is required"))
+		return
+	}
+
+	var refreshToken models.RefreshToken
+	result := db.DB.DB.Where("token_hash = ?", auth.HashToken(payload.RefreshToken)).Limit(1).Find(&refreshToken)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with logging out, try again"))
+		return
+	}
+	if refreshToken.ID != 0 {
+		err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+			if _, err := revokeSessions(tx, "family = ?", refreshToken.Family); err != nil {
+				return err
+			}
+			return revokeRefreshTokenFamily(tx, refreshToken.Family)
+		})
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with logging out, try again"))
+			return
+		}
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Logged out",
+	})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPBehind(t *testing.T) {
+	proxies := parseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "not-an-address"})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct request", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"forwarded header from an unknown peer is ignored", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy gives the client", "10.0.0.1:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"entries the client made up are skipped", "10.0.0.1:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chained proxies are walked from the right", "10.0.0.1:5000", []string{"1.2.3.4, 198.51.100.1, 192.168.1.5"}, "198.51.100.1"},
+		{"repeated headers are read as one list", "10.0.0.1:5000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"malformed entry stops the walk", "10.0.0.1:5000", []string{"198.51.100.1, garbage, 192.168.1.5"}, "192.168.1.5"},
+		{"trusted proxy without a header", "10.0.0.1:5000", nil, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/password/forgot", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := clientIPBehind(r, proxies); got != tt.want {
+				t.Errorf("clientIPBehind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
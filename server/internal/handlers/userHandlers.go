@@ -10,25 +10,34 @@ import (
 
 	"github.com/Brondont/E-Com-shop/db"
 	"github.com/Brondont/E-Com-shop/internal/auth"
+	"github.com/Brondont/E-Com-shop/internal/notify"
+	"github.com/Brondont/E-Com-shop/internal/payments"
 	"github.com/Brondont/E-Com-shop/middleware"
 	"github.com/Brondont/E-Com-shop/models"
 	"github.com/Brondont/E-Com-shop/utils"
 	"github.com/gorilla/mux"
 )
 
-type Handler struct{}
+type Handler struct {
+	payments payments.Provider
+	notifier notify.Notifier
+}
 
-func NewHandler() *Handler {
-	return &Handler{}
+// NewHandler shares one payment provider and notifier between every handler group
+func NewHandler(paymentProvider payments.Provider, notifier notify.Notifier) *Handler {
+	return &Handler{
+		payments: paymentProvider,
+		notifier: notifier,
+	}
 }
 
 type UserHandler struct {
 	*Handler
 }
 
-func NewUserHandler() *UserHandler {
+func NewUserHandler(handler *Handler) *UserHandler {
 	return &UserHandler{
-		Handler: NewHandler(),
+		Handler: handler,
 	}
 }
 
@@ -43,8 +52,8 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch user from database, excluding sensitive information
 	var user models.User
-	result := db.DB.DB.Select(
-		"id", "email", "username", "created_at", "phone_number", "is_admin",
+	result := db.DB.DB.Preload("Roles").Preload("Roles.Permissions").Select(
+		"id", "email", "username", "created_at", "phone_number", "email_verified_at",
 		// Add other non-sensitive fields you want to return
 	).Where("id = ?", userID).First(&user)
 
@@ -59,6 +68,7 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting the user, try again"))
 		return
 	}
+	user.IsAdmin = len(user.Roles) > 0
 
 	// Respond with user data
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
@@ -74,13 +84,6 @@ func (h *UserHandler) PutUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract isAdmin flag from the context
-	isAdmin, ok := r.Context().Value("isAdmin").(bool)
-	if !ok {
-		utils.WriteError(w, http.StatusUnauthorized, errors.New("admin status is missing in the token"))
-		return
-	}
-
 	// Parse the incoming JSON payload
 	var payload models.User
 	err := utils.ParseJson(r, &payload)
@@ -101,10 +104,27 @@ func (h *UserHandler) PutUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If the user is not an admin, ensure they can only edit their own account
-	if !isAdmin && existingUser.ID != uint(userID) {
-		utils.WriteError(w, http.StatusForbidden, errors.New("you do not have permission to edit this user"))
-		return
+	// Only users allowed to manage users can edit an account other than their own
+	if existingUser.ID != uint(userID) {
+		canManage, err := auth.UserCan(uint(userID), models.PermissionUsersManage)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with checking permissions, try again"))
+			return
+		}
+		if !canManage {
+			utils.WriteError(w, http.StatusForbidden, errors.New("you do not have permission to edit this user"))
+			return
+		}
+		if err := checkCanManageUser(uint(userID), existingUser.ID); err != nil {
+			writeManageUserError(w, err)
+			return
+		}
+	}
+
+	// A new email has to be verified again
+	emailChanged := existingUser.Email != payload.Email
+	if emailChanged {
+		existingUser.EmailVerifiedAt = nil
 	}
 
 	// Update the user's information
@@ -119,6 +139,11 @@ func (h *UserHandler) PutUser(w http.ResponseWriter, r *http.Request) {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the user, try again"))
 		return
 	}
+	if emailChanged {
+		if err := h.sendEmailVerification(existingUser); err != nil {
+			log.Printf("failed to send the verification email to user %d: %v", existingUser.ID, err)
+		}
+	}
 
 	// Respond with the updated user information
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
@@ -294,16 +319,40 @@ func (h *UserHandler) PostLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// password is correct create JWT and return proper response
-	token, err := auth.CreateJWT(user.ID, user.IsAdmin)
+	session, err := newSession(r, user)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
-
-	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
-		"message": "User validated",
-		"token":   token,
+	var tokens *loginTokens
+	err = db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tokens, err = issueLoginTokens(tx, user, session)
+		return err
 	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := tokens.response("User validated")
+
+	// A guest cart brought along is merged into the user's cart, failing to merge doesn't block the login
+	if cartToken := r.Header.Get(cartTokenHeader); cartToken != "" {
+		var cartMerge *cartMergeResult
+		err := db.DB.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			cartMerge, err = mergeGuestCart(tx, cartToken, user.ID)
+			return err
+		})
+		if err != nil {
+			log.Printf("failed to merge guest cart into the cart of user %d: %v", user.ID, err)
+		} else {
+			response["cartMerge"] = cartMerge
+		}
+	}
+
+	utils.WriteJson(w, http.StatusCreated, response)
 }
 
 // PostSignup handles user sign up
@@ -349,52 +398,197 @@ func (h *UserHandler) PostSignup(w http.ResponseWriter, r *http.Request) {
 	}
 	payload.Password = hashedPassword
 
-	// Create the user
+	// Create the user, the email stays unverified until the mailed link is opened and roles are only given by admins
+	payload.EmailVerifiedAt = nil
+	payload.Roles = nil
 	result = db.DB.DB.Create(&payload)
 	if result.Error != nil {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating your user, please try again"))
 		return
 	}
 
+	if err := h.sendEmailVerification(payload); err != nil {
+		log.Printf("failed to send the verification email to user %d: %v", payload.ID, err)
+	}
+
 	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
 		"message": "User created successfully",
 		"user":    payload,
 	})
 }
 
-func (h *UserHandler) GetCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		err := errors.New("no user ID found")
-		utils.WriteError(w, http.StatusUnauthorized, err)
+var (
+	errCartVariantNotFound = errors.New("product not found")
+	errCartStockExceeded   = errors.New("requested quantity exceeds available stock")
+)
+
+// writeCartOwnerError answers a failed requestCartOwner call
+func writeCartOwnerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errGuestCartNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
 		return
 	}
+	utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with loading the cart, try again"))
+}
 
-	var cartItems []models.CartItem
-	result := db.DB.DB.Preload("Variant").Preload("Variant.Images").Preload("Variant.Inventory").Where("user_id = ?", userID).Find(&cartItems)
+// addToCart adds quantity units of a variant to the owner's cart, adding to the existing line if there is one.
+// The whole line has to fit in the stock left. It reports whether a new line was created.
+func addToCart(tx *gorm.DB, owner cartOwner, variantID uint, quantity uint) (*models.CartItem, bool, error) {
+	var variant models.Variant
+	result := tx.Preload("Inventory").Where("ID = ?", variantID).First(&variant)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			utils.WriteError(w, http.StatusNotFound, errors.New("user has no cart items"))
+			return nil, false, errCartVariantNotFound
+		}
+		return nil, false, result.Error
+	}
+
+	// Validate the requested quantity
+	if quantity > variant.Inventory.Quantity {
+		return nil, false, errCartStockExceeded
+	}
+
+	// Check if the item already exists in the cart
+	var existingCartItem models.CartItem
+	result = owner.scope(tx).Where("variant_id = ?", variant.ID).First(&existingCartItem)
+	if result.Error == nil {
+		// Update the quantity if the item already exists
+		newQuantity := existingCartItem.Quantity + quantity
+
+		// Validate the new quantity against available stock
+		if newQuantity > variant.Inventory.Quantity {
+			return nil, false, errCartStockExceeded
+		}
+
+		existingCartItem.Quantity = newQuantity
+		existingCartItem.UnitPrice = variant.CurrentPrice
+		result = tx.Save(&existingCartItem)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		return &existingCartItem, false, nil
+	}
+
+	// Create a new cart item
+	cartItem := owner.newCartItem(variant.ID, quantity)
+	cartItem.UnitPrice = variant.CurrentPrice
+	result = tx.Create(&cartItem)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	return &cartItem, true, nil
+}
+
+// GetCart returns the cart with a summary priced the same way checkout will charge it.
+// Tax and shipping are estimated for the addressID and shippingMethodID query parameters,
+// falling back to the user's latest address and the cheapest method that delivers there.
+// Guests get the summary without coupon, tax and shipping since those need an account.
+func (h *UserHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	owner, err := requestCartOwner(w, r, false)
+	if err != nil {
+		writeCartOwnerError(w, err)
+		return
+	}
+
+	displayCurrency, err := requestCurrency(r)
+	if err != nil {
+		writeCurrencyError(w, err)
+		return
+	}
+
+	cartItems := []models.CartItem{}
+	if owner.exists() {
+		result := owner.scope(db.DB.DB.Preload("Variant").Preload("Variant.Images").Preload("Variant.Inventory").Preload("Variant.Product")).
+			Find(&cartItems)
+		if result.Error != nil {
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong"))
 			return
 		}
+	}
+
+	var userID uint
+	var address *models.Address
+	var shippingMethod *models.ShippingMethod
+	var coupon *models.Coupon
+	if owner.UserID != nil {
+		userID = *owner.UserID
+
+		addressQuery := db.DB.DB.Where("user_id = ?", userID)
+		if addressID := r.URL.Query().Get("addressID"); addressID != "" {
+			addressQuery = addressQuery.Where("id = ?", addressID)
+		}
+		var addresses []models.Address
+		result := addressQuery.Order("created_at DESC").Limit(1).Find(&addresses)
+		if result.Error != nil {
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			return
+		}
+		if len(addresses) > 0 {
+			address = &addresses[0]
+		} else if r.URL.Query().Get("addressID") != "" {
+			utils.WriteError(w, http.StatusNotFound, errors.New("address not found"))
+			return
+		}
+
+		if address != nil {
+			methodQuery := db.DB.DB.Preload("Rates").Where("active = ?", true)
+			if shippingMethodID := r.URL.Query().Get("shippingMethodID"); shippingMethodID != "" {
+				methodQuery = methodQuery.Where("id = ?", shippingMethodID)
+			}
+			var methods []models.ShippingMethod
+			result = methodQuery.Find(&methods)
+			if result.Error != nil {
+				utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong"))
+				return
+			}
+			if r.URL.Query().Get("shippingMethodID") != "" && len(methods) > 0 {
+				shippingMethod = &methods[0]
+			} else {
+				shippingMethod = cheapestShippingMethod(methods, *address, cartItems)
+			}
+		}
+
+		var cartCoupon models.CartCoupon
+		result = db.DB.DB.Where("user_id = ?", userID).Limit(1).Find(&cartCoupon)
+		if result.Error != nil {
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			return
+		}
+		if cartCoupon.ID != 0 {
+			coupon = &models.Coupon{}
+			result = db.DB.DB.Preload("Categories").Preload("Brands").Preload("Variants").First(coupon, cartCoupon.CouponID)
+			if result.Error != nil {
+				utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong"))
+				return
+			}
+		}
+	}
+
+	summary, err := priceCart(db.DB.DB, userID, cartItems, coupon, address, shippingMethod)
+	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong"))
 		return
 	}
 
+	// The summary is computed on base prices before anything is converted
+	displayCurrency.convertPricing(summary)
+	for i := range cartItems {
+		displayCurrency.convertVariant(&cartItems[i].Variant)
+		cartItems[i].UnitPrice = displayCurrency.convert(cartItems[i].UnitPrice)
+	}
+
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
 		"message":   "Fetched cart items successfully",
 		"cartItems": cartItems,
+		"summary":   summary,
+		"currency":  displayCurrency.Code,
 	})
 }
 
+// PostCart adds a variant to the cart. A guest without a cart token gets a new guest cart,
+// its token comes back in the X-Cart-Token header and as cartToken.
 func (h *UserHandler) PostCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		err := errors.New("no user ID found")
-		utils.WriteError(w, http.StatusUnauthorized, err)
-		return
-	}
-
 	var payload struct {
 		VariantID uint `json:"variantID"`
 		Quantity  uint `json:"quantity"`
@@ -405,84 +599,57 @@ func (h *UserHandler) PostCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the product exists
-	var variant models.Variant
-
-	result := db.DB.DB.Preload("Inventory").Where("ID = ?", payload.VariantID).First(&variant)
-
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			utils.WriteError(w, http.StatusNotFound, errors.New("product not found"))
-			return
-		}
-		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with adding variant to cart, try again"))
-		return
-	}
-
-	// Validate the requested quantity
-	if payload.Quantity > variant.Inventory.Quantity {
-		utils.WriteError(w, http.StatusBadRequest, errors.New("requested quantity exceeds available stock"))
+	owner, err := requestCartOwner(w, r, true)
+	if err != nil {
+		writeCartOwnerError(w, err)
 		return
 	}
 
-	// Check if the item already exists in the user's cart
-	var existingCartItem models.CartItem
-	result = db.DB.DB.Where("user_id = ? AND variant_id = ?", userID, variant.ID).First(&existingCartItem)
-	if result.Error == nil {
-		// Update the quantity if the item already exists
-		newQuantity := existingCartItem.Quantity + payload.Quantity
-
-		// Validate the new quantity against available stock
-		if newQuantity > variant.Inventory.Quantity {
-			utils.WriteError(w, http.StatusBadRequest, errors.New("requested quantity exceeds available stock"))
-			return
-		}
-
-		existingCartItem.Quantity = newQuantity
-		result = db.DB.DB.Save(&existingCartItem)
-		if result.Error != nil {
+	cartItem, created, err := addToCart(db.DB.DB, owner, payload.VariantID, payload.Quantity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errCartVariantNotFound):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, errCartStockExceeded):
+			utils.WriteError(w, http.StatusBadRequest, err)
+		default:
 			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with adding variant to cart, try again"))
-			return
 		}
-
-		utils.WriteJson(w, http.StatusOK, map[string]interface{}{
-			"message":  "Cart item updated",
-			"cartItem": existingCartItem,
-		})
 		return
 	}
 
-	// Create a new cart item
-	cartItem := models.CartItem{
-		UserID:    uint(userID),
-		VariantID: variant.ID,
-		Quantity:  payload.Quantity,
+	response := map[string]interface{}{
+		"message":  "Cart item updated",
+		"cartItem": cartItem,
+	}
+	if owner.GuestCart != nil {
+		response["cartToken"] = owner.GuestCart.Token
 	}
 
-	result = db.DB.DB.Create(&cartItem)
-
-	if result.Error != nil {
-		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating cart item, try again"))
+	if !created {
+		utils.WriteJson(w, http.StatusOK, response)
 		return
 	}
 
-	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
-		"message":  "Item added to cart",
-		"cartItem": cartItem,
-	})
+	response["message"] = "Item added to cart"
+	utils.WriteJson(w, http.StatusCreated, response)
 }
 
 func (h *UserHandler) DeleteCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		utils.WriteError(w, http.StatusUnauthorized, errors.New("token doesn't contain user id"))
+	owner, err := requestCartOwner(w, r, false)
+	if err != nil {
+		writeCartOwnerError(w, err)
+		return
+	}
+	if !owner.exists() {
+		utils.WriteError(w, http.StatusNotFound, errGuestCartNotFound)
 		return
 	}
 
 	vars := mux.Vars(r)
 	cartItemID := vars["cartItemID"]
 
-	result := db.DB.DB.Where("user_id = ? AND id = ?", userID, cartItemID).Delete(&models.CartItem{})
+	result := owner.scope(db.DB.DB).Where("id = ?", cartItemID).Delete(&models.CartItem{})
 	if result.Error != nil {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with deleting the cart item, try again"))
 		return
@@ -494,9 +661,14 @@ func (h *UserHandler) DeleteCart(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) UpdateCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		utils.WriteError(w, http.StatusUnauthorized, errors.New("token doesn't contain user id"))
+	owner, err := requestCartOwner(w, r, false)
+	if err != nil {
+		writeCartOwnerError(w, err)
+		return
+	}
+	if !owner.exists() {
+		utils.WriteError(w, http.StatusNotFound, errGuestCartNotFound)
+		return
 	}
 
 	var payload struct {
@@ -504,17 +676,19 @@ func (h *UserHandler) UpdateCart(w http.ResponseWriter, r *http.Request) {
 		NewQuantity uint `json:"newQuantity"`
 	}
 
-	err := utils.ParseJson(r, &payload)
+	err = utils.ParseJson(r, &payload)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	var cartItem models.CartItem
-	result := db.DB.DB.Preload("Variant").Preload("Variant.Images").Preload("Variant.Inventory").Where("user_id = ? AND id = ?", userID, payload.CartItemID).Find(&cartItem)
+	result := owner.scope(db.DB.DB.Preload("Variant").Preload("Variant.Images").Preload("Variant.Inventory")).
+		Where("id = ?", payload.CartItemID).First(&cartItem)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			utils.WriteError(w, http.StatusNotFound, errors.New("this cart items doesn't exist"))
+			return
 		}
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the quantity, try again"))
 		return
@@ -527,10 +701,12 @@ func (h *UserHandler) UpdateCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cartItem.Quantity = payload.NewQuantity
+	cartItem.UnitPrice = cartItem.Variant.CurrentPrice
 
 	updateResult := db.DB.DB.Save(&cartItem)
 	if updateResult.Error != nil {
 		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the quantity, try again"))
+		return
 	}
 
 	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/internal/payments"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+)
+
+const maxWebhookSize = 1 << 20 // 1MB
+
+type WebhookHandler struct {
+	*Handler
+}
+
+func NewWebhookHandler(handler *Handler) *WebhookHandler {
+	return &WebhookHandler{
+		Handler: handler,
+	}
+}
+
+// PostPaymentWebhook receives asynchronous payment notifications from the payment provider.
+// Events are stored by their provider ID so a retried delivery is only applied once.
+func (h *WebhookHandler) PostPaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookSize))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("unable to read webhook body"))
+		return
+	}
+
+	event, err := h.payments.VerifyWebhook(body, r.Header.Get("X-Payment-Signature"))
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tx := db.DB.DB.Begin()
+	if tx.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, tx.Error)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+	paymentEvent := models.PaymentEvent{
+		Provider:        h.payments.Name(),
+		ProviderEventID: event.ID,
+		Type:            event.Type,
+		Reference:       event.Reference,
+		Payload:         string(body),
+		ProcessedAt:     &now,
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&paymentEvent)
+	if result.Error != nil {
+		tx.Rollback()
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	// The event was stored by an earlier delivery
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+			"message": "Event already processed",
+		})
+		return
+	}
+
+	if err := h.applyPaymentEvent(r.Context(), tx, event); err != nil {
+		tx.Rollback()
+		log.Printf("payment event %s could not be applied: %v", event.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("event could not be processed"))
+		return
+	}
+
+	result = tx.Commit()
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Event processed",
+	})
+}
+
+// capturedEventAction is what a payment.captured event does to the payment it refers to
+type capturedEventAction int
+
+const (
+	capturedEventIgnore capturedEventAction = iota
+	capturedEventRecord
+	capturedEventRefund
+)
+
+// decideCapturedEvent only lets an authorized payment become captured. A payment we marked failed
+// was charged after all, it is recorded while its order still waits for the money. Money taken for
+// an order that was cancelled or paid otherwise, or for a hold we already voided, is given back.
+// Any other payment has moved past the capture and a late or replayed event must not bring it back.
+func decideCapturedEvent(paymentStatus models.PaymentStatus, orderStatus models.OrderStatus) capturedEventAction {
+	switch paymentStatus {
+	case models.PaymentStatusAuthorized:
+		if orderStatus == models.OrderStatusCancelled {
+			return capturedEventRefund
+		}
+		return capturedEventRecord
+	case models.PaymentStatusFailed:
+		if orderStatus == models.OrderStatusPending || orderStatus == models.OrderStatusPaymentFailed {
+			return capturedEventRecord
+		}
+		return capturedEventRefund
+	case models.PaymentStatusVoided:
+		return capturedEventRefund
+	default:
+		return capturedEventIgnore
+	}
+}
+
+// applyPaymentEvent updates the payment and its order according to a verified provider event
+func (h *WebhookHandler) applyPaymentEvent(ctx context.Context, tx *gorm.DB, event *payments.WebhookEvent) error {
+	if event.Type != payments.EventPaymentCaptured && event.Type != payments.EventPaymentFailed {
+		return nil
+	}
+
+	var payment models.Payment
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", event.Reference).Order("created_at DESC").First(&payment)
+	if result.Error != nil {
+		// Nothing of ours to update, the event stays stored for auditing
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			log.Printf("payment event %s references unknown payment %s", event.ID, event.Reference)
+			return nil
+		}
+		return result.Error
+	}
+
+	var order models.Order
+	result = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, payment.OrderID)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	switch event.Type {
+	case payments.EventPaymentCaptured:
+		action := decideCapturedEvent(payment.Status, order.Status)
+		if action == capturedEventIgnore {
+			log.Printf("payment event %s ignored, payment %d is already %s", event.ID, payment.ID, payment.Status)
+			return nil
+		}
+
+		result = tx.Model(&payment).Updates(map[string]interface{}{
+			"status":         models.PaymentStatusCaptured,
+			"failure_reason": "",
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		payment.Status = models.PaymentStatusCaptured
+
+		if action == capturedEventRefund {
+			log.Printf("payment %d was captured for %s order %d, refunding it", payment.ID, order.Status, order.ID)
+			_, err := h.refundPayment(ctx, tx, &payment, payment.Amount-payment.AmountRefunded)
+			return err
+		}
+
+		if order.Status.CanTransitionTo(models.OrderStatusPaid) {
+			return changeOrderStatus(tx, &order, models.OrderStatusPaid, nil, "Payment confirmed by provider")
+		}
+	case payments.EventPaymentFailed:
+		// A late failure can't undo a payment that already went further
+		if payment.Status != models.PaymentStatusAuthorized {
+			return nil
+		}
+
+		result = tx.Model(&payment).Updates(map[string]interface{}{
+			"status":         models.PaymentStatusFailed,
+			"failure_reason": event.Reason,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if order.Status.CanTransitionTo(models.OrderStatusPaymentFailed) {
+			return changeOrderStatus(tx, &order, models.OrderStatusPaymentFailed, nil, event.Reason)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+func TestDecideCapturedEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		paymentStatus models.PaymentStatus
+		orderStatus   models.OrderStatus
+		want          capturedEventAction
+	}{
+		{"authorized payment of a pending order is recorded", models.PaymentStatusAuthorized, models.OrderStatusPending, capturedEventRecord},
+		{"authorized payment of a failed order is recorded", models.PaymentStatusAuthorized, models.OrderStatusPaymentFailed, capturedEventRecord},
+		{"authorized payment of a cancelled order is refunded", models.PaymentStatusAuthorized, models.OrderStatusCancelled, capturedEventRefund},
+		{"voided payment is refunded", models.PaymentStatusVoided, models.OrderStatusCancelled, capturedEventRefund},
+		{"replayed capture is ignored", models.PaymentStatusCaptured, models.OrderStatusPaid, capturedEventIgnore},
+		{"refunded payment stays refunded", models.PaymentStatusRefunded, models.OrderStatusRefunded, capturedEventIgnore},
+		{"partially refunded payment stays partially refunded", models.PaymentStatusPartiallyRefunded, models.OrderStatusPartiallyRefunded, capturedEventIgnore},
+		{"failed payment of a failed order is recorded", models.PaymentStatusFailed, models.OrderStatusPaymentFailed, capturedEventRecord},
+		{"failed payment of a pending order is recorded", models.PaymentStatusFailed, models.OrderStatusPending, capturedEventRecord},
+		{"failed payment of a cancelled order is refunded", models.PaymentStatusFailed, models.OrderStatusCancelled, capturedEventRefund},
+		{"failed payment of an order paid otherwise is refunded", models.PaymentStatusFailed, models.OrderStatusPaid, capturedEventRefund},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideCapturedEvent(tt.paymentStatus, tt.orderStatus); got != tt.want {
+				t.Errorf("decideCapturedEvent(%s, %s) = %d, want %d", tt.paymentStatus, tt.orderStatus, got, tt.want)
+			}
+		})
+	}
+}
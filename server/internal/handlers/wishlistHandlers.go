@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/db"
+	"github.com/Brondont/E-Com-shop/models"
+	"github.com/Brondont/E-Com-shop/utils"
+	"github.com/gorilla/mux"
+)
+
+var nonSlugCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// wishlistSlug builds a shareable slug from the list name with a random suffix so names can repeat
+func wishlistSlug(name string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	base := strings.Trim(nonSlugCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(base) > 100 {
+		base = strings.Trim(base[:100], "-")
+	}
+	if base == "" {
+		base = "wishlist"
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+// findUserWishlist loads one of the user's wishlists with its items
+func findUserWishlist(tx *gorm.DB, userID int, wishlistID string) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	result := tx.Preload("Items").Preload("Items.Variant").Preload("Items.Variant.Images").
+		Where("id = ? AND user_id = ?", wishlistID, userID).First(&wishlist)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &wishlist, nil
+}
+
+// writeWishlistError answers a failed findUserWishlist call
+func writeWishlistError(w http.ResponseWriter, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.WriteError(w, http.StatusNotFound, errors.New("wishlist not found"))
+		return
+	}
+	utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting the wishlist, try again"))
+}
+
+func (h *UserHandler) GetWishlists(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var wishlists []models.Wishlist
+	result := db.DB.DB.Preload("Items").Preload("Items.Variant").Preload("Items.Variant.Images").
+		Where("user_id = ?", userID).Order("created_at ASC").Find(&wishlists)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting wishlists, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":   "Successfully fetched results",
+		"wishlists": wishlists,
+	})
+}
+
+func (h *UserHandler) GetWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	wishlist, err := findUserWishlist(db.DB.DB, userID, mux.Vars(r)["wishlistID"])
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Fetched wishlist",
+		"wishlist": wishlist,
+	})
+}
+
+// GetSharedWishlist shows a public wishlist to anyone who has its slug
+func (h *GeneralHandler) GetSharedWishlist(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+
+	var wishlist models.Wishlist
+	result := db.DB.DB.Preload("Items").Preload("Items.Variant").Preload("Items.Variant.Images").
+		Where("slug = ? AND is_public = ?", slug, true).First(&wishlist)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("wishlist not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with getting the wishlist, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Fetched wishlist",
+		"wishlist": wishlist,
+	})
+}
+
+func (h *UserHandler) PostWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var payload struct {
+		Name     string `json:"name"`
+		IsPublic bool   `json:"isPublic"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("wishlist name is required"))
+		return
+	}
+
+	slug, err := wishlistSlug(payload.Name)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the wishlist, try again"))
+		return
+	}
+
+	wishlist := models.Wishlist{
+		UserID:   uint(userID),
+		Name:     payload.Name,
+		Slug:     slug,
+		IsPublic: payload.IsPublic,
+		Items:    []models.WishlistItem{},
+	}
+	result := db.DB.DB.Create(&wishlist)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with creating the wishlist, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusCreated, map[string]interface{}{
+		"message":  "Wishlist created successfully",
+		"wishlist": wishlist,
+	})
+}
+
+// PutWishlist renames a wishlist and shares or unshares it, the slug stays the same so shared links keep working
+func (h *UserHandler) PutWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var payload struct {
+		ID       uint   `json:"ID"`
+		Name     string `json:"name"`
+		IsPublic bool   `json:"isPublic"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("wishlist ID is required"))
+		return
+	}
+	if payload.Name == "" {
+		utils.WriteError(w, http.StatusBadRequest, errors.New("wishlist name is required"))
+		return
+	}
+
+	wishlist, err := findUserWishlist(db.DB.DB, userID, fmt.Sprint(payload.ID))
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+
+	result := db.DB.DB.Model(wishlist).Updates(map[string]interface{}{
+		"name":      payload.Name,
+		"is_public": payload.IsPublic,
+	})
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with updating the wishlist, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Wishlist updated successfully",
+		"wishlist": wishlist,
+	})
+}
+
+func (h *UserHandler) DeleteWishlist(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	wishlist, err := findUserWishlist(db.DB.DB, userID, mux.Vars(r)["wishlistID"])
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+
+	err = db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("wishlist_id = ?", wishlist.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		// Slugs are unique, a hard delete frees it
+		return tx.Unscoped().Delete(wishlist).Error
+	})
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with deleting the wishlist, try again"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Wishlist was deleted.",
+	})
+}
+
+// PostWishlistItem saves a variant to a wishlist, saving it again updates the quantity
+func (h *UserHandler) PostWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	var payload struct {
+		VariantID uint `json:"variantID"`
+		Quantity  uint `json:"quantity"`
+	}
+	if err := utils.ParseJson(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.Quantity == 0 {
+		payload.Quantity = 1
+	}
+
+	wishlist, err := findUserWishlist(db.DB.DB, userID, mux.Vars(r)["wishlistID"])
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+
+	var variant models.Variant
+	result := db.DB.DB.First(&variant, payload.VariantID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("product not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with saving the item, try again"))
+		return
+	}
+
+	var wishlistItem models.WishlistItem
+	result = db.DB.DB.Where("wishlist_id = ? AND variant_id = ?", wishlist.ID, variant.ID).Limit(1).Find(&wishlistItem)
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with saving the item, try again"))
+		return
+	}
+
+	status := http.StatusOK
+	if wishlistItem.ID != 0 {
+		result = db.DB.DB.Model(&wishlistItem).Update("quantity", payload.Quantity)
+	} else {
+		status = http.StatusCreated
+		wishlistItem = models.WishlistItem{
+			WishlistID: wishlist.ID,
+			VariantID:  variant.ID,
+			Quantity:   payload.Quantity,
+		}
+		result = db.DB.DB.Create(&wishlistItem)
+	}
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with saving the item, try again"))
+		return
+	}
+	wishlistItem.Variant = variant
+
+	utils.WriteJson(w, status, map[string]interface{}{
+		"message":      "Item saved to wishlist",
+		"wishlistItem": wishlistItem,
+	})
+}
+
+func (h *UserHandler) DeleteWishlistItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	wishlist, err := findUserWishlist(db.DB.DB, userID, vars["wishlistID"])
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+
+	result := db.DB.DB.Unscoped().Where("id = ? AND wishlist_id = ?", vars["itemID"], wishlist.ID).Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with removing the item, try again"))
+		return
+	}
+	if result.RowsAffected == 0 {
+		utils.WriteError(w, http.StatusNotFound, errors.New("wishlist item not found"))
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message": "Item removed from wishlist",
+	})
+}
+
+// PostWishlistItemToCart moves a saved item into the cart with the same stock checks as PostCart.
+// The item leaves the wishlist only once it is in the cart.
+func (h *UserHandler) PostWishlistItemToCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		utils.WriteError(w, http.StatusUnauthorized, errors.New("no user ID found"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	wishlist, err := findUserWishlist(db.DB.DB, userID, vars["wishlistID"])
+	if err != nil {
+		writeWishlistError(w, err)
+		return
+	}
+
+	var wishlistItem models.WishlistItem
+	result := db.DB.DB.Where("id = ? AND wishlist_id = ?", vars["itemID"], wishlist.ID).First(&wishlistItem)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			utils.WriteError(w, http.StatusNotFound, errors.New("wishlist item not found"))
+			return
+		}
+		utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with moving the item, try again"))
+		return
+	}
+
+	id := uint(userID)
+	owner := cartOwner{UserID: &id}
+
+	var cartItem *models.CartItem
+	err = db.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		cartItem, _, err = addToCart(tx, owner, wishlistItem.VariantID, wishlistItem.Quantity)
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&wishlistItem).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errCartVariantNotFound):
+			utils.WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, errCartStockExceeded):
+			utils.WriteError(w, http.StatusBadRequest, err)
+		default:
+			utils.WriteError(w, http.StatusInternalServerError, errors.New("something went wrong with moving the item, try again"))
+		}
+		return
+	}
+
+	utils.WriteJson(w, http.StatusOK, map[string]interface{}{
+		"message":  "Item moved to cart",
+		"cartItem": cartItem,
+	})
+}
@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Brondont/E-Com-shop/config"
+	"github.com/Brondont/E-Com-shop/internal/notify"
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+// sendTimeout bounds how long a single reminder may take to go out
+const sendTimeout = 30 * time.Second
+
+// abandonedCart sums up a user's cart, LastActivity is the most recent change to any of its items
+type abandonedCart struct {
+	UserID       uint
+	LastActivity time.Time
+	ItemCount    int
+}
+
+// CartReminderJob reminds users of carts they stopped touching. Every attempt is recorded as a
+// CartReminder so a cart is reminded once per idle period and failed sends are retried a few times.
+// Only carts of logged in users are considered, guest carts have nobody to write to.
+type CartReminderJob struct {
+	db          *gorm.DB
+	notifier    notify.Notifier
+	idleAfter   time.Duration
+	interval    time.Duration
+	maxAttempts int
+}
+
+func NewCartReminderJob(db *gorm.DB, notifier notify.Notifier, idleAfter time.Duration, interval time.Duration, maxAttempts int) *CartReminderJob {
+	return &CartReminderJob{
+		db:          db,
+		notifier:    notifier,
+		idleAfter:   idleAfter,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Start runs the job right away and then every interval until ctx is cancelled
+func (j *CartReminderJob) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			sent, err := j.Run(ctx, time.Now())
+			if err != nil {
+				log.Printf("Cart reminder run failed: %v", err)
+			} else if sent > 0 {
+				log.Printf("Sent %d cart reminders", sent)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run reminds the owners of every cart idle since before now minus the idle threshold and returns how many reminders went out.
+// A failed send is recorded and left for the next run, it doesn't stop the others.
+func (j *CartReminderJob) Run(ctx context.Context, now time.Time) (int, error) {
+	var carts []abandonedCart
+	result := j.db.Model(&models.CartItem{}).
+		Select("user_id, MAX(updated_at) AS last_activity, COUNT(*) AS item_count").
+		Where("user_id IS NOT NULL").
+		Group("user_id").
+		Having("MAX(updated_at) < ?", now.Add(-j.idleAfter)).
+		Scan(&carts)
+	if result.Error != nil {
+		return 0, fmt.Errorf("find abandoned carts: %w", result.Error)
+	}
+
+	sent := 0
+	for _, cart := range carts {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		due, err := j.isDue(cart)
+		if err != nil {
+			return sent, err
+		}
+		if !due {
+			continue
+		}
+
+		if err := j.remind(ctx, cart); err != nil {
+			log.Printf("Failed to send cart reminder to user %d: %v", cart.UserID, err)
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// isDue reports whether a cart still needs a reminder for its current idle period
+func (j *CartReminderJob) isDue(cart abandonedCart) (bool, error) {
+	var attempts []models.CartReminder
+	result := j.db.Where("user_id = ? AND cart_updated_at >= ?", cart.UserID, cart.LastActivity).Find(&attempts)
+	if result.Error != nil {
+		return false, fmt.Errorf("load cart reminders for user %d: %w", cart.UserID, result.Error)
+	}
+
+	failed := 0
+	for _, attempt := range attempts {
+		if attempt.Status == models.ReminderStatusSent {
+			return false, nil
+		}
+		failed++
+	}
+	return failed < j.maxAttempts, nil
+}
+
+// remind sends the reminder for one cart and records the attempt whatever its outcome
+func (j *CartReminderJob) remind(ctx context.Context, cart abandonedCart) error {
+	var user models.User
+	if result := j.db.First(&user, cart.UserID); result.Error != nil {
+		return fmt.Errorf("load user: %w", result.Error)
+	}
+
+	var cartItems []models.CartItem
+	result := j.db.Preload("Variant").Where("user_id = ?", cart.UserID).Order("created_at ASC").Find(&cartItems)
+	if result.Error != nil {
+		return fmt.Errorf("load cart items: %w", result.Error)
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	sendErr := j.notifier.Send(sendCtx, cartReminderMessage(user, cartItems))
+
+	reminder := models.CartReminder{
+		UserID:        cart.UserID,
+		CartUpdatedAt: cart.LastActivity,
+		ItemCount:     cart.ItemCount,
+		Channel:       j.notifier.Name(),
+		Status:        models.ReminderStatusSent,
+	}
+	if sendErr != nil {
+		reminder.Status = models.ReminderStatusFailed
+		reminder.Error = sendErr.Error()
+	}
+	if result := j.db.Create(&reminder); result.Error != nil {
+		return fmt.Errorf("record cart reminder: %w", result.Error)
+	}
+
+	return sendErr
+}
+
+// cartReminderMessage writes the reminder listing what is left in the cart
+func cartReminderMessage(user models.User, cartItems []models.CartItem) notify.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\nYou left these items in your cart:\n", user.Username)
+	for _, cartItem := range cartItems {
+		if cartItem.Variant.ID == 0 {
+			continue
+		}
+		fmt.Fprintf(&body, "- %d x %s at %s %s\n", cartItem.Quantity, cartItem.Variant.Name, cartItem.Variant.CurrentPrice, config.Envs.BaseCurrency)
+	}
+	body.WriteString("\nThey are still waiting for you, come back to finish your order.")
+
+	return notify.Message{
+		To:      user.Email,
+		Subject: "You left something in your cart",
+		Body:    body.String(),
+	}
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// OrderExpirer cancels the unpaid orders placed before a cutoff and returns how many it cancelled
+type OrderExpirer interface {
+	ExpireUnpaidOrders(ctx context.Context, placedBefore time.Time) (int, error)
+}
+
+// UnpaidOrderJob gives back the stock and coupon use held by orders that were never paid for, such as
+// orders whose payment failed or whose checkout was cut off after the reservation was committed
+type UnpaidOrderJob struct {
+	expirer   OrderExpirer
+	expiresIn time.Duration
+	interval  time.Duration
+}
+
+func NewUnpaidOrderJob(expirer OrderExpirer, expiresIn time.Duration, interval time.Duration) *UnpaidOrderJob {
+	return &UnpaidOrderJob{
+		expirer:   expirer,
+		expiresIn: expiresIn,
+		interval:  interval,
+	}
+}
+
+// Start runs the job right away and then every interval until ctx is cancelled
+func (j *UnpaidOrderJob) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			expired, err := j.Run(ctx, time.Now())
+			if err != nil {
+				log.Printf("Unpaid order run failed: %v", err)
+			} else if expired > 0 {
+				log.Printf("Cancelled %d unpaid orders", expired)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run cancels the orders still unpaid after the expiry period and returns how many were cancelled
+func (j *UnpaidOrderJob) Run(ctx context.Context, now time.Time) (int, error) {
+	return j.expirer.ExpireUnpaidOrders(ctx, now.Add(-j.expiresIn))
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordingExpirer struct {
+	placedBefore time.Time
+}
+
+func (e *recordingExpirer) ExpireUnpaidOrders(ctx context.Context, placedBefore time.Time) (int, error) {
+	e.placedBefore = placedBefore
+	return 2, nil
+}
+
+func TestUnpaidOrderJobRunCutoff(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	expirer := &recordingExpirer{}
+
+	expired, err := NewUnpaidOrderJob(expirer, time.Hour, time.Minute).Run(context.Background(), now)
+	if err != nil {
+		t.Fatalf("Run() unexpected error: %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("Run() = %d, want 2", expired)
+	}
+	if want := now.Add(-time.Hour); !expirer.placedBefore.Equal(want) {
+		t.Errorf("orders placed before %s were expired, want before %s", expirer.placedBefore, want)
+	}
+}
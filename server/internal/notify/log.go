@@ -0,0 +1,22 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// LogNotifier writes notifications to the server log instead of delivering them, it is meant for local development
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Name() string {
+	return "log"
+}
+
+func (n *LogNotifier) Send(ctx context.Context, msg Message) error {
+	log.Printf("Notification to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
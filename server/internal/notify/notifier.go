@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Brondont/E-Com-shop/config"
+)
+
+// Message is a notification addressed to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier is implemented by every channel the shop can reach customers through
+type Notifier interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPConfig holds where the smtp notifier delivers mail and who it is sent as
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	From     string
+	Username string
+	Password string
+}
+
+// NewNotifier returns the notifier registered under name
+func NewNotifier(name string, smtpConfig SMTPConfig) (Notifier, error) {
+	switch name {
+	case "", "log":
+		return NewLogNotifier(), nil
+	case "smtp":
+		return NewSMTPNotifier(smtpConfig), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", name)
+	}
+}
+
+// NewNotifierFromEnv returns the notifier picked by the environment configuration
+func NewNotifierFromEnv() (Notifier, error) {
+	return NewNotifier(config.Envs.Notifier, SMTPConfig{
+		Host:     config.Envs.SMTPHost,
+		Port:     config.Envs.SMTPPort,
+		From:     config.Envs.SMTPFrom,
+		Username: config.Envs.SMTPUsername,
+		Password: config.Envs.SMTPPassword,
+	})
+}
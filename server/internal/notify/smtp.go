@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPNotifier sends notifications as plain text mail. Pointed at a local catch-all server
+// such as MailHog it stands in for a real mail provider.
+type SMTPNotifier struct {
+	config SMTPConfig
+}
+
+func NewSMTPNotifier(config SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{
+		config: config,
+	}
+}
+
+func (n *SMTPNotifier) Name() string {
+	return "smtp"
+}
+
+// Send delivers the message, authenticating only when a username is configured
+func (n *SMTPNotifier) Send(ctx context.Context, msg Message) error {
+	if n.config.Host == "" || n.config.From == "" {
+		return errors.New("smtp notifier needs a host and a from address")
+	}
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return errors.New("mail headers can't contain line breaks")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		n.config.From, msg.To, msg.Subject, strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	addr := net.JoinHostPort(n.config.Host, n.config.Port)
+	if err := smtp.SendMail(addr, auth, n.config.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
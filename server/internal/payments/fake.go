@@ -0,0 +1,150 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+// Test card numbers understood by the fake provider, every other valid number is approved
+const (
+	FakeCardDeclined          = "4000000000000002"
+	FakeCardInsufficientFunds = "4000000000009995"
+)
+
+// FakeProvider is a deterministic in-process gateway used for local development and tests.
+// It keeps no state, references are derived from the order so the same input always gives the same output.
+type FakeProvider struct {
+	webhookSecret string
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{
+		webhookSecret: webhookSecret,
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Authorize validates the card number and approves it unless it is one of the declining test cards
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*Transaction, error) {
+	card := strings.ReplaceAll(strings.ReplaceAll(req.Source, " ", ""), "-", "")
+	if !isValidCardNumber(card) {
+		return nil, ErrInvalidCard
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount %s", req.Amount)
+	}
+
+	switch card {
+	case FakeCardDeclined:
+		return nil, ErrCardDeclined
+	case FakeCardInsufficientFunds:
+		return nil, fmt.Errorf("%w: insufficient funds", ErrCardDeclined)
+	}
+
+	return &Transaction{
+		Reference: fmt.Sprintf("fake_%d_%s", req.OrderID, card[len(card)-4:]),
+		Status:    TransactionAuthorized,
+		Amount:    req.Amount,
+	}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, reference string, amount models.Money) (*Transaction, error) {
+	if !strings.HasPrefix(reference, "fake_") {
+		return nil, ErrUnknownReference
+	}
+
+	return &Transaction{
+		Reference: reference,
+		Status:    TransactionCaptured,
+		Amount:    amount,
+	}, nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, reference string) (*Transaction, error) {
+	if !strings.HasPrefix(reference, "fake_") {
+		return nil, ErrUnknownReference
+	}
+
+	return &Transaction{
+		Reference: reference,
+		Status:    TransactionVoided,
+	}, nil
+}
+
+// Refund derives the refund reference from the idempotency key so a repeated call gives the same refund
+func (p *FakeProvider) Refund(ctx context.Context, reference string, amount models.Money, idempotencyKey string) (*Transaction, error) {
+	if !strings.HasPrefix(reference, "fake_") {
+		return nil, ErrUnknownReference
+	}
+
+	return &Transaction{
+		Reference: fmt.Sprintf("%s_refund_%s", reference, idempotencyKey),
+		Status:    TransactionRefunded,
+		Amount:    amount,
+	}, nil
+}
+
+// VerifyWebhook checks the hex encoded HMAC-SHA256 of the payload before decoding the event
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("decode webhook event: %w", err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, fmt.Errorf("webhook event is missing its id or type")
+	}
+
+	return &event, nil
+}
+
+// Sign returns the signature the fake provider expects for payload, handy to simulate webhooks
+func (p *FakeProvider) Sign(payload []byte) string {
+	return hex.EncodeToString(p.sign(payload))
+}
+
+func (p *FakeProvider) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// isValidCardNumber runs the Luhn checksum on a card number
+func isValidCardNumber(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+
+	return sum%10 == 0
+}
@@ -0,0 +1,89 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Brondont/E-Com-shop/models"
+)
+
+var (
+	ErrInvalidCard      = errors.New("card details are invalid")
+	ErrCardDeclined     = errors.New("card was declined")
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	ErrUnknownReference = errors.New("unknown payment reference")
+)
+
+type TransactionStatus string
+
+const (
+	TransactionAuthorized TransactionStatus = "authorized"
+	TransactionCaptured   TransactionStatus = "captured"
+	TransactionRefunded   TransactionStatus = "refunded"
+	TransactionVoided     TransactionStatus = "voided"
+	TransactionFailed     TransactionStatus = "failed"
+)
+
+// Webhook event types the shop reacts to, any other type is stored and acknowledged
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+)
+
+// AuthorizeRequest holds what a provider needs to put a hold on the customer's funds
+type AuthorizeRequest struct {
+	OrderID  uint
+	Amount   models.Money
+	Currency string
+	// Source is the card number or the provider token identifying the payment method
+	Source string
+}
+
+// Transaction is the provider's answer to an authorize, capture, void or refund call
+type Transaction struct {
+	Reference string
+	Status    TransactionStatus
+	Amount    models.Money
+}
+
+// WebhookEvent is a verified asynchronous notification sent by a provider
+type WebhookEvent struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	Reference string       `json:"reference"`
+	Amount    models.Money `json:"amount"`
+	Reason    string       `json:"reason,omitempty"`
+}
+
+// Provider is implemented by every payment gateway the shop can charge through
+type Provider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Transaction, error)
+	Capture(ctx context.Context, reference string, amount models.Money) (*Transaction, error)
+	// Void releases the hold of an authorization that was never captured
+	Void(ctx context.Context, reference string) (*Transaction, error)
+	// Refund is idempotent on idempotencyKey, repeating a call returns the refund already made
+	Refund(ctx context.Context, reference string, amount models.Money, idempotencyKey string) (*Transaction, error)
+	VerifyWebhook(payload []byte, signature string) (*WebhookEvent, error)
+}
+
+// NewProvider returns the provider registered under name. There is no default, charging through the
+// fake gateway by accident would approve every order, and a webhook secret is always required.
+func NewProvider(name string, webhookSecret string) (Provider, error) {
+	if name == "" {
+		return nil, errors.New("no payment provider configured, set PaymentProvider")
+	}
+	if webhookSecret == "" {
+		return nil, errors.New("no payment webhook secret configured, set PaymentWebhookSecret")
+	}
+
+	switch name {
+	case "fake":
+		log.Printf("Payments go through the fake provider, every valid card number is approved")
+		return NewFakeProvider(webhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
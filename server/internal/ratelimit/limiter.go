@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// window counts the hits of one key since the window started
+type window struct {
+	start time.Time
+	hits  int
+}
+
+// Limiter allows a key a number of hits per fixed window of time. It keeps its counts in memory,
+// so every server instance limits on its own.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   int
+	period  time.Duration
+	windows map[string]*window
+	swept   time.Time
+}
+
+func NewLimiter(limit int, period time.Duration) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		period:  period,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow records a hit for key at now and reports whether it stays within the limit
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.forgetExpired(now)
+
+	current, ok := l.windows[key]
+	if !ok || now.Sub(current.start) >= l.period {
+		current = &window{start: now}
+		l.windows[key] = current
+	}
+	if current.hits >= l.limit {
+		return false
+	}
+	current.hits++
+	return true
+}
+
+// forgetExpired drops the windows that ended so the map doesn't grow with every key ever seen,
+// the map is walked at most once per period
+func (l *Limiter) forgetExpired(now time.Time) {
+	if now.Sub(l.swept) < l.period {
+		return
+	}
+	l.swept = now
+
+	for key, current := range l.windows {
+		if now.Sub(current.start) >= l.period {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		key  string
+		at   time.Duration
+		want bool
+	}{
+		{"first hit", "a", 0, true},
+		{"second hit", "a", time.Second, true},
+		{"third hit is over the limit", "a", 2 * time.Second, false},
+		{"other keys have their own count", "b", 3 * time.Second, true},
+		{"still limited before the window ends", "a", 59 * time.Second, false},
+		{"a new window starts after the period", "a", time.Minute, true},
+	}
+
+	limiter := NewLimiter(2, time.Minute)
+	for _, tt := range tests {
+		if got := limiter.Allow(tt.key, start.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: Allow(%q) = %t, want %t", tt.name, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterForgetsExpiredKeys(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	limiter := NewLimiter(1, time.Minute)
+	limiter.Allow("a", start)
+	limiter.Allow("b", start)
+	limiter.Allow("c", start.Add(2*time.Minute))
+
+	if len(limiter.windows) != 1 {
+		t.Errorf("limiter keeps %d windows, want only the live one", len(limiter.windows))
+	}
+}
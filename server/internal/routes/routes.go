@@ -6,13 +6,15 @@ import (
 
 	"github.com/Brondont/E-Com-shop/internal/auth"
 	"github.com/Brondont/E-Com-shop/internal/handlers"
+	"github.com/Brondont/E-Com-shop/models"
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes(router *mux.Router) {
-	userHandler := handlers.NewUserHandler()
-	adminHandler := handlers.NewAdminHandler()
-	generalHandler := handlers.NewGeneralHandler()
+func SetupRoutes(router *mux.Router, handler *handlers.Handler) {
+	userHandler := handlers.NewUserHandler(handler)
+	adminHandler := handlers.NewAdminHandler(handler)
+	generalHandler := handlers.NewGeneralHandler(handler)
+	webhookHandler := handlers.NewWebhookHandler(handler)
 
 	// General Routes
 	router.HandleFunc("/categories", generalHandler.GetCategories).Methods("GET")
@@ -20,41 +22,114 @@ func SetupRoutes(router *mux.Router) {
 	router.HandleFunc("/products", generalHandler.GetProducts).Methods("GET")
 	router.HandleFunc("/product/{productID}", generalHandler.GetProduct).Methods("GET")
 	router.HandleFunc("/variants/{productID}", generalHandler.GetVariants).Methods("GET")
+	router.HandleFunc("/wishlists/shared/{slug}", generalHandler.GetSharedWishlist).Methods("GET")
 
 	// User routes
 	router.HandleFunc("/user", auth.IsAuth(userHandler.GetUser)).Methods("GET")
 	router.HandleFunc("/user", auth.IsAuth(userHandler.PutUser)).Methods("PUT")
+	router.HandleFunc("/sessions", auth.IsAuth(userHandler.GetSessions)).Methods("GET")
+	router.HandleFunc("/sessions", auth.IsAuth(userHandler.DeleteSessions)).Methods("DELETE")
+	router.HandleFunc("/session/{sessionID:[0-9]+}", auth.IsAuth(userHandler.DeleteSession)).Methods("DELETE")
 	router.HandleFunc("/addresses", auth.IsAuth(userHandler.GetAddresses)).Methods("GET")
 	router.HandleFunc("/address", auth.IsAuth(userHandler.PostAddress)).Methods("POST")
 	router.HandleFunc("/address", auth.IsAuth(userHandler.PutAddress)).Methods("PUT")
-	router.HandleFunc("/cart", auth.IsAuth(userHandler.GetCart)).Methods("GET")
-	router.HandleFunc("/cart", auth.IsAuth(userHandler.PostCart)).Methods("POST")
-	router.HandleFunc("/cart/{cartItemID}", auth.IsAuth(userHandler.DeleteCart)).Methods("DELETE")
-	router.HandleFunc("/cart", auth.IsAuth(userHandler.UpdateCart)).Methods("PUT")
+	router.HandleFunc("/cart", auth.OptionalAuth(userHandler.GetCart)).Methods("GET")
+	router.HandleFunc("/cart", auth.OptionalAuth(userHandler.PostCart)).Methods("POST")
+	router.HandleFunc("/cart/{cartItemID:[0-9]+}", auth.OptionalAuth(userHandler.DeleteCart)).Methods("DELETE")
+	router.HandleFunc("/cart", auth.OptionalAuth(userHandler.UpdateCart)).Methods("PUT")
+	router.HandleFunc("/cart/coupon", auth.IsAuth(userHandler.PostCartCoupon)).Methods("POST")
+	router.HandleFunc("/cart/coupon", auth.IsAuth(userHandler.DeleteCartCoupon)).Methods("DELETE")
+	router.HandleFunc("/cart/shipping", auth.IsAuth(userHandler.GetShippingQuote)).Methods("GET")
+	router.HandleFunc("/wishlists", auth.IsAuth(userHandler.GetWishlists)).Methods("GET")
+	router.HandleFunc("/wishlists/{wishlistID:[0-9]+}", auth.IsAuth(userHandler.GetWishlist)).Methods("GET")
+	router.HandleFunc("/wishlist", auth.IsAuth(userHandler.PostWishlist)).Methods("POST")
+	router.HandleFunc("/wishlist", auth.IsAuth(userHandler.PutWishlist)).Methods("PUT")
+	router.HandleFunc("/wishlist/{wishlistID:[0-9]+}", auth.IsAuth(userHandler.DeleteWishlist)).Methods("DELETE")
+	router.HandleFunc("/wishlists/{wishlistID:[0-9]+}/items", auth.IsAuth(userHandler.PostWishlistItem)).Methods("POST")
+	router.HandleFunc("/wishlists/{wishlistID:[0-9]+}/items/{itemID:[0-9]+}", auth.IsAuth(userHandler.DeleteWishlistItem)).Methods("DELETE")
+	router.HandleFunc("/wishlists/{wishlistID:[0-9]+}/items/{itemID:[0-9]+}/move-to-cart", auth.IsAuth(userHandler.PostWishlistItemToCart)).Methods("POST")
+	router.HandleFunc("/checkout", auth.IsAuth(userHandler.PostCheckout)).Methods("POST")
+	router.HandleFunc("/orders", auth.IsAuth(userHandler.GetOrders)).Methods("GET")
+	router.HandleFunc("/orders/{orderID}", auth.IsAuth(userHandler.GetOrder)).Methods("GET")
+	router.HandleFunc("/orders/{orderID}/cancel", auth.IsAuth(userHandler.PostCancelOrder)).Methods("POST")
+	router.HandleFunc("/orders/{orderID}/tracking", auth.IsAuth(userHandler.GetOrderTracking)).Methods("GET")
 
 	// Admin Routes
-	router.HandleFunc("/users", auth.IsAdmin(adminHandler.GetUsers)).Methods("GET")
-	router.HandleFunc("/users/{userID}", auth.IsAdmin(adminHandler.DeleteUser)).Methods("DELETE")
+	router.HandleFunc("/users", auth.Require(models.PermissionUsersRead)(adminHandler.GetUsers)).Methods("GET")
+	router.HandleFunc("/users/{userID}", auth.Require(models.PermissionUsersDelete)(adminHandler.DeleteUser)).Methods("DELETE")
+	router.HandleFunc("/users/{userID}/sessions", auth.Require(models.PermissionUsersManage)(adminHandler.DeleteUserSessions)).Methods("DELETE")
 
-	router.HandleFunc("/category", auth.IsAdmin(adminHandler.PostCategory)).Methods("POST")
-	router.HandleFunc("/category", auth.IsAdmin(adminHandler.PutCategory)).Methods("PUT")
-	router.HandleFunc("/category/{categoryID}", auth.IsAdmin(adminHandler.DeleteCategory)).Methods("DELETE")
+	router.HandleFunc("/users/{userID}/roles", auth.Require(models.PermissionRolesManage)(adminHandler.PostUserRole)).Methods("POST")
+	router.HandleFunc("/users/{userID}/roles/{roleID}", auth.Require(models.PermissionRolesManage)(adminHandler.DeleteUserRole)).Methods("DELETE")
+	router.HandleFunc("/roles", auth.Require(models.PermissionRolesManage)(adminHandler.GetRoles)).Methods("GET")
+	router.HandleFunc("/role", auth.Require(models.PermissionRolesManage)(adminHandler.PostRole)).Methods("POST")
+	router.HandleFunc("/role", auth.Require(models.PermissionRolesManage)(adminHandler.PutRole)).Methods("PUT")
+	router.HandleFunc("/role/{roleID}", auth.Require(models.PermissionRolesManage)(adminHandler.DeleteRole)).Methods("DELETE")
+	router.HandleFunc("/permissions", auth.Require(models.PermissionRolesManage)(adminHandler.GetPermissions)).Methods("GET")
 
-	router.HandleFunc("/brand", auth.IsAdmin(adminHandler.PostBrand)).Methods("POST")
-	router.HandleFunc("/brand", auth.IsAdmin(adminHandler.PutBrand)).Methods("PUT")
-	router.HandleFunc("/brand/{brandID}", auth.IsAdmin(adminHandler.DeleteBrand)).Methods("DELETE")
+	router.HandleFunc("/category", auth.Require(models.PermissionCatalogWrite)(adminHandler.PostCategory)).Methods("POST")
+	router.HandleFunc("/category", auth.Require(models.PermissionCatalogWrite)(adminHandler.PutCategory)).Methods("PUT")
+	router.HandleFunc("/category/{categoryID}", auth.Require(models.PermissionCatalogWrite)(adminHandler.DeleteCategory)).Methods("DELETE")
 
-	router.HandleFunc("/product", auth.IsAdmin(adminHandler.PostProduct)).Methods("POST")
-	router.HandleFunc("/product", auth.IsAuth(adminHandler.PutProduct)).Methods("PUT")
-	router.HandleFunc("/product/{productID}", auth.IsAdmin(adminHandler.DeleteProduct)).Methods("DELETE")
+	router.HandleFunc("/brand", auth.Require(models.PermissionCatalogWrite)(adminHandler.PostBrand)).Methods("POST")
+	router.HandleFunc("/brand", auth.Require(models.PermissionCatalogWrite)(adminHandler.PutBrand)).Methods("PUT")
+	router.HandleFunc("/brand/{brandID}", auth.Require(models.PermissionCatalogWrite)(adminHandler.DeleteBrand)).Methods("DELETE")
 
-	router.HandleFunc("/variant", auth.IsAdmin(adminHandler.PostVariant)).Methods("POST")
-	router.HandleFunc("/variant/{variantID}", auth.IsAdmin(adminHandler.DeleteVariant)).Methods("DELETE")
-	router.HandleFunc("/variant", auth.IsAdmin((adminHandler.PutVariant))).Methods("PUT")
+	router.HandleFunc("/product", auth.Require(models.PermissionCatalogWrite)(adminHandler.PostProduct)).Methods("POST")
+	router.HandleFunc("/product", auth.Require(models.PermissionCatalogWrite)(adminHandler.PutProduct)).Methods("PUT")
+	router.HandleFunc("/product/{productID}", auth.Require(models.PermissionCatalogWrite)(adminHandler.DeleteProduct)).Methods("DELETE")
+
+	router.HandleFunc("/variant", auth.Require(models.PermissionCatalogWrite)(adminHandler.PostVariant)).Methods("POST")
+	router.HandleFunc("/variant/{variantID}", auth.Require(models.PermissionCatalogWrite)(adminHandler.DeleteVariant)).Methods("DELETE")
+	router.HandleFunc("/variant", auth.Require(models.PermissionCatalogWrite)(adminHandler.PutVariant)).Methods("PUT")
+	router.HandleFunc("/variants/{variantID}/inventory", auth.Require(models.PermissionInventoryWrite)(adminHandler.PutVariantInventory)).Methods("PUT")
+
+	router.HandleFunc("/shipping-methods", auth.Require(models.PermissionSettingsManage)(adminHandler.GetShippingMethods)).Methods("GET")
+	router.HandleFunc("/shipping-method", auth.Require(models.PermissionSettingsManage)(adminHandler.PostShippingMethod)).Methods("POST")
+	router.HandleFunc("/shipping-method", auth.Require(models.PermissionSettingsManage)(adminHandler.PutShippingMethod)).Methods("PUT")
+	router.HandleFunc("/shipping-method/{shippingMethodID}", auth.Require(models.PermissionSettingsManage)(adminHandler.DeleteShippingMethod)).Methods("DELETE")
+
+	router.HandleFunc("/tax-rules", auth.Require(models.PermissionSettingsManage)(adminHandler.GetTaxRules)).Methods("GET")
+	router.HandleFunc("/tax-rule", auth.Require(models.PermissionSettingsManage)(adminHandler.PostTaxRule)).Methods("POST")
+	router.HandleFunc("/tax-rule", auth.Require(models.PermissionSettingsManage)(adminHandler.PutTaxRule)).Methods("PUT")
+	router.HandleFunc("/tax-rule/{taxRuleID}", auth.Require(models.PermissionSettingsManage)(adminHandler.DeleteTaxRule)).Methods("DELETE")
+
+	router.HandleFunc("/coupons", auth.Require(models.PermissionMarketing)(adminHandler.GetCoupons)).Methods("GET")
+	router.HandleFunc("/coupon", auth.Require(models.PermissionMarketing)(adminHandler.PostCoupon)).Methods("POST")
+	router.HandleFunc("/coupon", auth.Require(models.PermissionMarketing)(adminHandler.PutCoupon)).Methods("PUT")
+	router.HandleFunc("/coupon/{couponID}", auth.Require(models.PermissionMarketing)(adminHandler.DeleteCoupon)).Methods("DELETE")
+
+	router.HandleFunc("/promotions", auth.Require(models.PermissionMarketing)(adminHandler.GetPromotions)).Methods("GET")
+	router.HandleFunc("/promotion", auth.Require(models.PermissionMarketing)(adminHandler.PostPromotion)).Methods("POST")
+	router.HandleFunc("/promotion", auth.Require(models.PermissionMarketing)(adminHandler.PutPromotion)).Methods("PUT")
+	router.HandleFunc("/promotion/{promotionID}", auth.Require(models.PermissionMarketing)(adminHandler.DeletePromotion)).Methods("DELETE")
+
+	router.HandleFunc("/exchange-rates", auth.Require(models.PermissionSettingsManage)(adminHandler.GetExchangeRates)).Methods("GET")
+	router.HandleFunc("/exchange-rate", auth.Require(models.PermissionSettingsManage)(adminHandler.PostExchangeRate)).Methods("POST")
+	router.HandleFunc("/exchange-rate", auth.Require(models.PermissionSettingsManage)(adminHandler.PutExchangeRate)).Methods("PUT")
+	router.HandleFunc("/exchange-rate/{exchangeRateID}", auth.Require(models.PermissionSettingsManage)(adminHandler.DeleteExchangeRate)).Methods("DELETE")
+	router.HandleFunc("/exchange-rates/import", auth.Require(models.PermissionSettingsManage)(adminHandler.PostExchangeRatesImport)).Methods("POST")
+
+	router.HandleFunc("/admin/orders", auth.Require(models.PermissionOrdersRead)(adminHandler.GetAllOrders)).Methods("GET")
+	router.HandleFunc("/admin/orders/{orderID}", auth.Require(models.PermissionOrdersRead)(adminHandler.GetOrderDetails)).Methods("GET")
+	router.HandleFunc("/orders/{orderID}/status", auth.Require(models.PermissionOrdersManage)(adminHandler.PutOrderStatus)).Methods("PUT")
+	router.HandleFunc("/orders/{orderID}/refunds", auth.Require(models.PermissionOrdersRefund)(adminHandler.PostRefund)).Methods("POST")
+	router.HandleFunc("/orders/{orderID}/shipments", auth.Require(models.PermissionOrdersManage)(adminHandler.PostShipment)).Methods("POST")
+	router.HandleFunc("/shipments/{shipmentID}/events", auth.Require(models.PermissionOrdersManage)(adminHandler.PostShipmentEvent)).Methods("POST")
 
 	// Auth Routes
 	router.HandleFunc("/login", userHandler.PostLogin).Methods("POST")
 	router.HandleFunc("/signup", userHandler.PostSignup).Methods("POST")
+	router.HandleFunc("/token/refresh", userHandler.PostTokenRefresh).Methods("POST")
+	router.HandleFunc("/logout", userHandler.PostLogout).Methods("POST")
+	router.HandleFunc("/password/forgot", userHandler.PostForgotPassword).Methods("POST")
+	router.HandleFunc("/password/reset", userHandler.PostResetPassword).Methods("POST")
+	router.HandleFunc("/verify-email", userHandler.GetVerifyEmail).Methods("GET")
+	router.HandleFunc("/verify-email/resend", auth.IsAuth(userHandler.PostResendVerification)).Methods("POST")
+
+	// Webhook Routes
+	router.HandleFunc("/webhooks/payments", webhookHandler.PostPaymentWebhook).Methods("POST")
+	router.HandleFunc("/webhooks/carriers", webhookHandler.PostCarrierWebhook).Methods("POST")
 }
 
 func SetupStaticRoutes(router *mux.Router) {
@@ -69,6 +69,22 @@ func ValidateUserInput(payload models.User) []InputValidationError {
 	return errors
 }
 
+// ValidateNewPassword: validates a password chosen outside of sign up, such as on a reset
+func ValidateNewPassword(password string) []InputValidationError {
+	var errors []InputValidationError
+
+	if err := validatePassword(password); err != nil {
+		errors = append(errors, InputValidationError{
+			Type:  "invalid",
+			Value: "[hidden]",
+			Msg:   err.Error(),
+			Path:  "password",
+		})
+	}
+
+	return errors
+}
+
 // ValidateUserAddress: validates wether the payload fields are empty
 func ValidateUserAddress(payload models.Address) []InputValidationError {
 	var errors []InputValidationError
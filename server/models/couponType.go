@@ -0,0 +1,18 @@
+package models
+
+type CouponType string
+
+const (
+	CouponTypePercentage   CouponType = "percentage"
+	CouponTypeFixed        CouponType = "fixed"
+	CouponTypeFreeShipping CouponType = "free_shipping"
+)
+
+// IsValid reports whether the type is one of the known coupon types
+func (t CouponType) IsValid() bool {
+	switch t {
+	case CouponTypePercentage, CouponTypeFixed, CouponTypeFreeShipping:
+		return true
+	}
+	return false
+}
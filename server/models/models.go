@@ -12,7 +12,75 @@ type User struct {
 	Email       string `json:"email" gorm:"type:varchar(100);not null;unique"`
 	Password    string `json:"password" gorm:"type:text;not null"`
 	PhoneNumber string `json:"phoneNumber" gorm:"type:varchar(100);unique"`
-	IsAdmin     bool   `json:"isAdmin" gorm:"default:false"`
+	// EmailVerifiedAt is set once the user opened the link mailed to their address
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	Roles           []Role     `json:"roles,omitempty" gorm:"many2many:user_roles;constraint:OnDelete:CASCADE"`
+	// IsAdmin tells clients the user holds a role and should see the admin panel, it is filled in when roles are loaded
+	IsAdmin bool `json:"isAdmin" gorm:"-"`
+}
+
+// Role is a named set of permissions given to users
+type Role struct {
+	gorm.Model
+	Name        string       `json:"name" gorm:"type:varchar(100);not null;uniqueIndex"`
+	Description string       `json:"description" gorm:"type:text"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;constraint:OnDelete:CASCADE"`
+}
+
+// Permission is one action a role can allow, the names come from PermissionCatalog
+type Permission struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"type:varchar(100);not null;uniqueIndex"`
+	Description string `json:"description" gorm:"type:text"`
+}
+
+// RefreshToken lets a user get a new login token without signing in again. Tokens are single use,
+// each refresh revokes the token and issues its replacement in the same family.
+type RefreshToken struct {
+	gorm.Model
+	UserID    uint       `json:"userID" gorm:"index;not null"`
+	User      User       `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Family    string     `json:"-" gorm:"type:varchar(64);not null;index"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	// ReplacedByID points to the token issued when this one was used
+	ReplacedByID *uint `json:"replacedByID"`
+}
+
+// PasswordResetToken is a single use token emailed to reset a forgotten password, only its hash is stored
+type PasswordResetToken struct {
+	gorm.Model
+	UserID    uint       `json:"userID" gorm:"index;not null"`
+	User      User       `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+// EmailVerificationToken is a single use token mailed to confirm a user owns their email, only its hash is stored
+type EmailVerificationToken struct {
+	gorm.Model
+	UserID    uint       `json:"userID" gorm:"index;not null"`
+	User      User       `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	TokenHash string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expiresAt" gorm:"not null"`
+	UsedAt    *time.Time `json:"usedAt"`
+}
+
+// Session is one login of a user on a device. TokenID is the jti of the access token currently
+// issued for it and Family ties it to its refresh tokens, revoking the session logs the device out.
+type Session struct {
+	gorm.Model
+	UserID     uint       `json:"userID" gorm:"index;not null"`
+	User       User       `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	TokenID    string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Family     string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	UserAgent  string     `json:"userAgent" gorm:"type:varchar(255)"`
+	IP         string     `json:"ip" gorm:"type:varchar(45)"`
+	LastSeenAt time.Time  `json:"lastSeenAt" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expiresAt" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revokedAt"`
 }
 
 type Category struct {
@@ -57,11 +125,23 @@ type Variant struct {
 	ProductID   uint      `json:"productID"`
 	Name        string    `json:"name" gorm:"type:varchar(100);not null"`
 	Description string    `json:"description" gorm:"type:text"`
-	Price       float64   `json:"price" gorm:"type:decimal(10,2);not null"`
+	Price       Money     `json:"price" gorm:"type:bigint;not null"`
+	Currency    string    `json:"currency" gorm:"type:varchar(3)"`
+	Weight      float64   `json:"weight" gorm:"type:decimal(10,3);not null;default:0"`
 	ModelUrl    string    `json:"modelURL" gorm:"type:text"`
 	Images      []Image   `json:"images" gorm:"foreignKey:VariantID"`
 	Inventory   Inventory `json:"inventory" gorm:"foreignKey:VariantID"`
 	Product     Product   `json:"product" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+
+	// A sale price only applies between its optional start and end dates
+	CompareAtPrice *Money     `json:"compareAtPrice" gorm:"type:bigint"`
+	SalePrice      *Money     `json:"salePrice" gorm:"type:bigint"`
+	SaleStartsAt   *time.Time `json:"saleStartsAt"`
+	SaleEndsAt     *time.Time `json:"saleEndsAt"`
+
+	// Computed when the variant is loaded, see AfterFind
+	CurrentPrice Money `json:"currentPrice" gorm:"-"`
+	OnSale       bool  `json:"onSale" gorm:"-"`
 }
 
 type Inventory struct {
@@ -90,24 +170,256 @@ type OrderItem struct {
 	VariantID uint    `json:"variantID"`
 	Variant   Variant `json:"variant" gorm:"constraint:OnDelete:CASCADE"`
 	Quantity  int     `json:"quantity" gorm:"type:int;not null"`
-	Price     float64 `json:"price" gorm:"type:decimal(10,2);not null"`
+	Price     Money   `json:"price" gorm:"type:bigint;not null"`
+
+	RefundedQuantity int `json:"refundedQuantity" gorm:"type:int;not null;default:0"`
+
+	TaxRate  float64 `json:"taxRate" gorm:"type:decimal(6,3);not null;default:0"`
+	Tax      Money   `json:"tax" gorm:"type:bigint;not null;default:0"`
+	Discount Money   `json:"discount" gorm:"type:bigint;not null;default:0"`
 }
 
 type Order struct {
 	gorm.Model
-	UserID     uint        `json:"userID"`
-	User       User        `json:"user" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Total      float64     `json:"total" gorm:"type:decimal(10,2);not null"`
-	Status     string      `json:"status" gorm:"type:varchar(50);not null;default:'Pending'"`
-	OrderItems []OrderItem `json:"orderItems" gorm:"foreignKey:OrderID"`
-	AddressID  uint        `json:"addressID"`
-	Address    Address     `json:"address" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	UserID        uint                 `json:"userID"`
+	User          User                 `json:"user" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Subtotal      Money                `json:"subtotal" gorm:"type:bigint;not null;default:0"`
+	DiscountTotal Money                `json:"discountTotal" gorm:"type:bigint;not null;default:0"`
+	TaxTotal      Money                `json:"taxTotal" gorm:"type:bigint;not null;default:0"`
+	Total         Money                `json:"total" gorm:"type:bigint;not null"`
+	Currency      string               `json:"currency" gorm:"type:varchar(3)"`
+	Status        OrderStatus          `json:"status" gorm:"type:varchar(50);not null;default:'Pending'"`
+	OrderItems    []OrderItem          `json:"orderItems" gorm:"foreignKey:OrderID"`
+	AddressID     uint                 `json:"addressID"`
+	Address       Address              `json:"address" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	StatusHistory []OrderStatusHistory `json:"statusHistory,omitempty" gorm:"foreignKey:OrderID"`
+	CancelReason  string               `json:"cancelReason,omitempty" gorm:"type:text"`
+	Payments      []Payment            `json:"payments,omitempty" gorm:"foreignKey:OrderID"`
+	Refunds       []Refund             `json:"refunds,omitempty" gorm:"foreignKey:OrderID"`
+
+	ShippingMethodID *uint          `json:"shippingMethodID"`
+	ShippingMethod   ShippingMethod `json:"shippingMethod" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	ShippingCost     Money          `json:"shippingCost" gorm:"type:bigint;not null;default:0"`
+	Shipments        []Shipment     `json:"shipments,omitempty" gorm:"foreignKey:OrderID"`
+
+	CouponID   *uint  `json:"couponID"`
+	CouponCode string `json:"couponCode,omitempty" gorm:"type:varchar(50)"`
+}
+
+type Payment struct {
+	gorm.Model
+	OrderID        uint          `json:"orderID" gorm:"index;not null"`
+	Provider       string        `json:"provider" gorm:"type:varchar(50);not null"`
+	Reference      string        `json:"reference" gorm:"type:varchar(255);index"`
+	Amount         Money         `json:"amount" gorm:"type:bigint;not null"`
+	AmountRefunded Money         `json:"amountRefunded" gorm:"type:bigint;not null;default:0"`
+	Status         PaymentStatus `json:"status" gorm:"type:varchar(50);not null"`
+	FailureReason  string        `json:"failureReason,omitempty" gorm:"type:text"`
+}
+
+type Refund struct {
+	gorm.Model
+	OrderID           uint         `json:"orderID" gorm:"index;not null"`
+	PaymentID         uint         `json:"paymentID" gorm:"index;not null"`
+	Amount            Money        `json:"amount" gorm:"type:bigint;not null"`
+	Reason            string       `json:"reason" gorm:"type:text"`
+	Restocked         bool         `json:"restocked" gorm:"default:false"`
+	CreatedByID       uint         `json:"createdByID"`
+	ProviderReference string       `json:"providerReference" gorm:"type:varchar(255)"`
+	Items             []RefundItem `json:"items" gorm:"foreignKey:RefundID"`
+}
+
+type RefundItem struct {
+	gorm.Model
+	RefundID    uint  `json:"refundID" gorm:"index;not null"`
+	OrderItemID uint  `json:"orderItemID" gorm:"index;not null"`
+	Quantity    int   `json:"quantity" gorm:"type:int;not null"`
+	Amount      Money `json:"amount" gorm:"type:bigint;not null"`
+}
+
+type PaymentEvent struct {
+	gorm.Model
+	Provider        string     `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_payment_events_provider_event"`
+	ProviderEventID string     `json:"providerEventID" gorm:"type:varchar(255);not null;uniqueIndex:idx_payment_events_provider_event"`
+	Type            string     `json:"type" gorm:"type:varchar(100);not null"`
+	Reference       string     `json:"reference" gorm:"type:varchar(255);index"`
+	Payload         string     `json:"payload" gorm:"type:text"`
+	ProcessedAt     *time.Time `json:"processedAt"`
 }
 
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderID     uint        `json:"orderID" gorm:"index;not null"`
+	FromStatus  OrderStatus `json:"fromStatus" gorm:"type:varchar(50)"`
+	ToStatus    OrderStatus `json:"toStatus" gorm:"type:varchar(50);not null"`
+	ChangedByID *uint       `json:"changedByID"`
+	Note        string      `json:"note" gorm:"type:text"`
+}
+
+// CartItem belongs to either a user or a guest cart, the other owner is left null
 type CartItem struct {
 	gorm.Model
-	UserID    uint    `json:"userID" gorm:"constraint:OnDelete:CASCADE"`
-	VariantID uint    `json:"variantID" gorm:"constraint:OnDelete:CASCADE"`
-	Variant   Variant `json:"variant" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Quantity  uint    `json:"quantity" gorm:"type:int;not null"`
+	UserID      *uint   `json:"userID" gorm:"index"`
+	GuestCartID *uint   `json:"guestCartID,omitempty" gorm:"index"`
+	VariantID   uint    `json:"variantID" gorm:"constraint:OnDelete:CASCADE"`
+	Variant     Variant `json:"variant" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Quantity    uint    `json:"quantity" gorm:"type:int;not null"`
+	// UnitPrice is what the variant sold for when the line was last added or changed
+	UnitPrice Money `json:"unitPrice" gorm:"type:bigint;not null;default:0"`
+}
+
+// GuestCart holds the cart of an anonymous visitor, identified by the opaque token it was given
+type GuestCart struct {
+	gorm.Model
+	Token string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Items []CartItem `json:"items" gorm:"foreignKey:GuestCartID;constraint:OnDelete:CASCADE"`
+}
+
+// Wishlist is a named list of variants a user saved for later, a public list can be viewed by anyone with its slug
+type Wishlist struct {
+	gorm.Model
+	UserID   uint           `json:"userID" gorm:"index;not null"`
+	Name     string         `json:"name" gorm:"type:varchar(100);not null"`
+	Slug     string         `json:"slug" gorm:"type:varchar(150);not null;uniqueIndex"`
+	IsPublic bool           `json:"isPublic" gorm:"not null;default:false"`
+	Items    []WishlistItem `json:"items" gorm:"foreignKey:WishlistID;constraint:OnDelete:CASCADE"`
+}
+
+type WishlistItem struct {
+	gorm.Model
+	WishlistID uint    `json:"wishlistID" gorm:"index;not null"`
+	VariantID  uint    `json:"variantID" gorm:"index;not null"`
+	Variant    Variant `json:"variant" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Quantity   uint    `json:"quantity" gorm:"type:int;not null;default:1"`
+}
+
+// CartReminder records one attempt at reminding a user of a cart they left behind.
+// CartUpdatedAt is the last change to the cart it was for, a cart touched again later can be reminded again.
+type CartReminder struct {
+	gorm.Model
+	UserID        uint           `json:"userID" gorm:"index;not null"`
+	User          User           `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	CartUpdatedAt time.Time      `json:"cartUpdatedAt" gorm:"index;not null"`
+	ItemCount     int            `json:"itemCount" gorm:"not null"`
+	Channel       string         `json:"channel" gorm:"type:varchar(50);not null"`
+	Status        ReminderStatus `json:"status" gorm:"type:varchar(50);not null"`
+	Error         string         `json:"error,omitempty" gorm:"type:text"`
+}
+
+type ShippingMethod struct {
+	gorm.Model
+	Name        string         `json:"name" gorm:"type:varchar(100);not null"`
+	Carrier     string         `json:"carrier" gorm:"type:varchar(100)"`
+	Description string         `json:"description" gorm:"type:text"`
+	Active      bool           `json:"active" gorm:"not null;default:false"`
+	Rates       []ShippingRate `json:"rates" gorm:"foreignKey:ShippingMethodID"`
+}
+
+// ShippingRate prices a shipping method for a destination and a cart weight or subtotal range.
+// Empty country or state match any destination, zero maximums mean no upper limit.
+type ShippingRate struct {
+	gorm.Model
+	ShippingMethodID uint    `json:"shippingMethodID" gorm:"index;not null"`
+	Country          string  `json:"country" gorm:"type:varchar(100)"`
+	State            string  `json:"state" gorm:"type:varchar(100)"`
+	MinWeight        float64 `json:"minWeight" gorm:"type:decimal(10,3);not null;default:0"`
+	MaxWeight        float64 `json:"maxWeight" gorm:"type:decimal(10,3);not null;default:0"`
+	MinSubtotal      Money   `json:"minSubtotal" gorm:"type:bigint;not null;default:0"`
+	MaxSubtotal      Money   `json:"maxSubtotal" gorm:"type:bigint;not null;default:0"`
+	Price            Money   `json:"price" gorm:"type:bigint;not null"`
+}
+
+type Shipment struct {
+	gorm.Model
+	OrderID        uint            `json:"orderID" gorm:"index;not null"`
+	Carrier        string          `json:"carrier" gorm:"type:varchar(100);not null;index:idx_shipments_tracking"`
+	TrackingNumber string          `json:"trackingNumber" gorm:"type:varchar(100);not null;index:idx_shipments_tracking"`
+	Status         ShipmentStatus  `json:"status" gorm:"type:varchar(50);not null"`
+	ShippedAt      *time.Time      `json:"shippedAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt"`
+	Events         []ShipmentEvent `json:"events" gorm:"foreignKey:ShipmentID"`
+}
+
+type ShipmentEvent struct {
+	gorm.Model
+	ShipmentID  uint           `json:"shipmentID" gorm:"index;not null"`
+	Status      ShipmentStatus `json:"status" gorm:"type:varchar(50);not null"`
+	Location    string         `json:"location" gorm:"type:varchar(255)"`
+	Description string         `json:"description" gorm:"type:text"`
+	OccurredAt  time.Time      `json:"occurredAt" gorm:"not null"`
+	// CarrierEventID is set for events pushed by a carrier so redelivered webhooks are ignored
+	CarrierEventID *string `json:"carrierEventID,omitempty" gorm:"type:varchar(255);uniqueIndex"`
+}
+
+// TaxRule applies a percentage rate to order lines shipped to a country, optionally narrowed to a state and a category
+type TaxRule struct {
+	gorm.Model
+	Name       string    `json:"name" gorm:"type:varchar(100);not null"`
+	Country    string    `json:"country" gorm:"type:varchar(100);not null;index"`
+	State      string    `json:"state" gorm:"type:varchar(100)"`
+	CategoryID *uint     `json:"categoryID" gorm:"index"`
+	Category   *Category `json:"category,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Rate       float64   `json:"rate" gorm:"type:decimal(6,3);not null"`
+}
+
+// Coupon is a discount code. Empty category, brand and variant lists mean the coupon applies to the whole cart,
+// otherwise only the lines matching one of them are discounted. Zero limits mean unlimited.
+// Amount is only used by fixed coupons and PercentBasisPoints by percentage coupons, 1250 meaning 12.5%.
+type Coupon struct {
+	gorm.Model
+	Code               string     `json:"code" gorm:"type:varchar(50);not null;uniqueIndex"`
+	Description        string     `json:"description" gorm:"type:text"`
+	Type               CouponType `json:"type" gorm:"type:varchar(50);not null"`
+	Amount             Money      `json:"amount" gorm:"type:bigint;not null;default:0"`
+	PercentBasisPoints int64      `json:"percentBasisPoints" gorm:"type:bigint;not null;default:0"`
+	MinSubtotal        Money      `json:"minSubtotal" gorm:"type:bigint;not null;default:0"`
+	StartsAt           *time.Time `json:"startsAt"`
+	ExpiresAt          *time.Time `json:"expiresAt"`
+	UsageLimit         int        `json:"usageLimit" gorm:"type:int;not null;default:0"`
+	PerUserLimit       int        `json:"perUserLimit" gorm:"type:int;not null;default:0"`
+	TimesUsed          int        `json:"timesUsed" gorm:"type:int;not null;default:0"`
+	Active             bool       `json:"active" gorm:"not null;default:false"`
+	Categories         []Category `json:"categories" gorm:"many2many:coupon_categories"`
+	Brands             []Brand    `json:"brands" gorm:"many2many:coupon_brands"`
+	Variants           []Variant  `json:"variants" gorm:"many2many:coupon_variants"`
+}
+
+type CouponRedemption struct {
+	gorm.Model
+	CouponID uint  `json:"couponID" gorm:"index;not null"`
+	UserID   uint  `json:"userID" gorm:"index;not null"`
+	OrderID  uint  `json:"orderID" gorm:"index;not null"`
+	Amount   Money `json:"amount" gorm:"type:bigint;not null"`
+}
+
+// CartCoupon is the coupon a user applied to their cart, it is revalidated at checkout
+type CartCoupon struct {
+	gorm.Model
+	UserID   uint   `json:"userID" gorm:"uniqueIndex;not null"`
+	CouponID uint   `json:"couponID" gorm:"not null"`
+	Coupon   Coupon `json:"coupon" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// Promotion is an automatic discount on the variants it lists, no code is needed.
+// Buy X get Y discounts the cheapest Y units of every X+Y eligible units by DiscountPercent,
+// a bundle discounts every complete set of its variants by DiscountPercent.
+type Promotion struct {
+	gorm.Model
+	Name            string        `json:"name" gorm:"type:varchar(100);not null"`
+	Description     string        `json:"description" gorm:"type:text"`
+	Type            PromotionType `json:"type" gorm:"type:varchar(50);not null"`
+	BuyQuantity     int           `json:"buyQuantity" gorm:"type:int;not null;default:0"`
+	GetQuantity     int           `json:"getQuantity" gorm:"type:int;not null;default:0"`
+	DiscountPercent float64       `json:"discountPercent" gorm:"type:decimal(6,3);not null"`
+	StartsAt        *time.Time    `json:"startsAt"`
+	EndsAt          *time.Time    `json:"endsAt"`
+	Active          bool          `json:"active" gorm:"not null;default:false"`
+	Variants        []Variant     `json:"variants" gorm:"many2many:promotion_variants"`
+}
+
+// ExchangeRate converts base currency amounts for display, Rate is how much of Currency one base unit buys
+type ExchangeRate struct {
+	gorm.Model
+	Currency string  `json:"currency" gorm:"type:varchar(3);not null;uniqueIndex"`
+	Rate     float64 `json:"rate" gorm:"type:decimal(18,8);not null"`
 }
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in minor units (cents), sums of Money never drift.
+// It is stored as a bigint and sent in JSON as a decimal number such as 12.34.
+type Money int64
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// ParseMoney reads a decimal amount such as "12.34" without going through a float
+func ParseMoney(value string) (Money, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, ErrInvalidMoney
+	}
+
+	negative := false
+	if value[0] == '-' || value[0] == '+' {
+		negative = value[0] == '-'
+		value = value[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" && fraction == "" {
+		return 0, ErrInvalidMoney
+	}
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("%w: at most two decimals are allowed", ErrInvalidMoney)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseUint(whole+fraction, 10, 63)
+	if err != nil {
+		return 0, ErrInvalidMoney
+	}
+
+	if negative {
+		return -Money(units), nil
+	}
+	return Money(units), nil
+}
+
+// String formats the amount as a decimal with two places
+func (m Money) String() string {
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/100, units%100)
+}
+
+// Float64 is the amount in major units, only meant for display and ratios
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent returns rate percent of the amount rounded half away from zero
+func (m Money) Percent(rate float64) Money {
+	return Money(math.Round(float64(m) * rate / 100))
+}
+
+// BasisPoints returns points hundredths of a percent of the amount rounded half away from zero
+func (m Money) BasisPoints(points int64) Money {
+	return Money(math.Round(float64(m) * float64(points) / 10000))
+}
+
+// Share returns the part of the amount proportional to part over whole
+func (m Money) Share(part, whole Money) Money {
+	if whole == 0 {
+		return 0
+	}
+	return Money(math.Round(float64(m) * float64(part) / float64(whole)))
+}
+
+// Fraction returns numerator/denominator of the amount, used to split a line amount by quantity
+func (m Money) Fraction(numerator, denominator int) Money {
+	return m.Share(Money(numerator), Money(denominator))
+}
+
+// MinMoney returns the smaller of two amounts
+func MinMoney(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// MaxMoney returns the larger of two amounts
+func MaxMoney(a, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "null" {
+		return nil
+	}
+
+	parsed, err := ParseMoney(value)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
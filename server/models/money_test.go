@@ -0,0 +1,22 @@
+package models
+
+import "testing"
+
+func TestBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount Money
+		points int64
+		want   Money
+	}{
+		{1000, 1250, 125},
+		{999, 1000, 100},
+		{1, 5000, 1},
+		{2500, 10000, 2500},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.BasisPoints(tt.points); got != tt.want {
+			t.Errorf("%s.BasisPoints(%d) = %s, want %s", tt.amount, tt.points, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import "fmt"
+
+type OrderStatus string
+
+const (
+	OrderStatusPending       OrderStatus = "Pending"
+	OrderStatusPaymentFailed OrderStatus = "PaymentFailed"
+	OrderStatusPaid          OrderStatus = "Paid"
+	OrderStatusProcessing    OrderStatus = "Processing"
+	OrderStatusShipped       OrderStatus = "Shipped"
+	OrderStatusDelivered     OrderStatus = "Delivered"
+	OrderStatusCancelled     OrderStatus = "Cancelled"
+	OrderStatusRefunded      OrderStatus = "Refunded"
+
+	OrderStatusPartiallyRefunded OrderStatus = "PartiallyRefunded"
+)
+
+// OrderStatusTransitions lists the statuses an order is allowed to move to from each status
+var OrderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:           {OrderStatusPaid, OrderStatusPaymentFailed, OrderStatusCancelled},
+	OrderStatusPaymentFailed:     {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:              {OrderStatusProcessing, OrderStatusCancelled, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusProcessing:        {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusShipped:           {OrderStatusDelivered, OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusDelivered:         {OrderStatusRefunded, OrderStatusPartiallyRefunded},
+	OrderStatusPartiallyRefunded: {OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusCancelled:         {},
+	OrderStatusRefunded:          {},
+}
+
+// AdminOrderStatuses are the statuses staff may set by hand. Paid only follows a captured payment
+// and the refund statuses only follow a refund, so the flows that move the money set those.
+var AdminOrderStatuses = map[OrderStatus]bool{
+	OrderStatusProcessing: true,
+	OrderStatusShipped:    true,
+	OrderStatusDelivered:  true,
+	OrderStatusCancelled:  true,
+}
+
+// IsValid reports whether the status is one of the known order statuses
+func (s OrderStatus) IsValid() bool {
+	_, ok := OrderStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an order in this status may move to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range OrderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTransition returns an error describing why the order can't move to next
+func (s OrderStatus) ValidateTransition(next OrderStatus) error {
+	if !next.IsValid() {
+		return fmt.Errorf("unknown order status %q", next)
+	}
+	if !s.CanTransitionTo(next) {
+		return fmt.Errorf("order can't go from %s to %s", s, next)
+	}
+	return nil
+}
+
+// ValidateAdminTransition is ValidateTransition for a status set by hand, which also has to be one
+// of AdminOrderStatuses
+func (s OrderStatus) ValidateAdminTransition(next OrderStatus) error {
+	if err := s.ValidateTransition(next); err != nil {
+		return err
+	}
+	if !AdminOrderStatuses[next] {
+		return fmt.Errorf("order can't be set to %s by hand, it follows the payment or a refund", next)
+	}
+	return nil
+}
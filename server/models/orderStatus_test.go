@@ -0,0 +1,33 @@
+package models
+
+import "testing"
+
+func TestValidateAdminTransition(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    OrderStatus
+		to      OrderStatus
+		wantErr bool
+	}{
+		{"paid order is processed", OrderStatusPaid, OrderStatusProcessing, false},
+		{"processing order is shipped", OrderStatusProcessing, OrderStatusShipped, false},
+		{"shipped order is delivered", OrderStatusShipped, OrderStatusDelivered, false},
+		{"pending order is cancelled", OrderStatusPending, OrderStatusCancelled, false},
+		{"pending order can't be marked paid", OrderStatusPending, OrderStatusPaid, true},
+		{"failed order can't be marked paid", OrderStatusPaymentFailed, OrderStatusPaid, true},
+		{"pending order can't be marked failed", OrderStatusPending, OrderStatusPaymentFailed, true},
+		{"paid order can't be marked refunded", OrderStatusPaid, OrderStatusRefunded, true},
+		{"delivered order can't be marked partially refunded", OrderStatusDelivered, OrderStatusPartiallyRefunded, true},
+		{"disallowed transition is still refused", OrderStatusDelivered, OrderStatusProcessing, true},
+		{"unknown status", OrderStatusPaid, OrderStatus("Lost"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.from.ValidateAdminTransition(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("%s.ValidateAdminTransition(%s) error = %v, want error %t", tt.from, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
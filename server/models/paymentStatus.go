@@ -0,0 +1,13 @@
+package models
+
+type PaymentStatus string
+
+const (
+	PaymentStatusAuthorized PaymentStatus = "Authorized"
+	PaymentStatusCaptured   PaymentStatus = "Captured"
+	PaymentStatusFailed     PaymentStatus = "Failed"
+	PaymentStatusRefunded   PaymentStatus = "Refunded"
+	PaymentStatusVoided     PaymentStatus = "Voided"
+
+	PaymentStatusPartiallyRefunded PaymentStatus = "PartiallyRefunded"
+)
@@ -0,0 +1,54 @@
+package models
+
+// Permissions a role can grant, routes require them through auth.Require
+const (
+	PermissionUsersRead      = "users:read"
+	PermissionUsersManage    = "users:manage"
+	PermissionUsersDelete    = "users:delete"
+	PermissionRolesManage    = "roles:manage"
+	PermissionCatalogWrite   = "catalog:write"
+	PermissionInventoryWrite = "inventory:write"
+	PermissionMarketing      = "marketing:manage"
+	PermissionSettingsManage = "settings:manage"
+	PermissionOrdersRead     = "orders:read"
+	PermissionOrdersManage   = "orders:manage"
+	PermissionOrdersRefund   = "orders:refund"
+)
+
+// Roles created on startup. The admin role always holds every permission and can't be edited.
+const (
+	RoleAdmin     = "admin"
+	RoleWarehouse = "warehouse"
+)
+
+// PermissionCatalog lists every permission with what it grants
+var PermissionCatalog = []Permission{
+	{Name: PermissionUsersRead, Description: "List users"},
+	{Name: PermissionUsersManage, Description: "Edit other users and end their sessions"},
+	{Name: PermissionUsersDelete, Description: "Delete users"},
+	{Name: PermissionRolesManage, Description: "Create roles and assign them to users"},
+	{Name: PermissionCatalogWrite, Description: "Create, edit and delete categories, brands, products and variants"},
+	{Name: PermissionInventoryWrite, Description: "Change stock levels"},
+	{Name: PermissionMarketing, Description: "Manage coupons and promotions"},
+	{Name: PermissionSettingsManage, Description: "Manage shipping methods, tax rules and exchange rates"},
+	{Name: PermissionOrdersRead, Description: "View every order"},
+	{Name: PermissionOrdersManage, Description: "Change order status and record shipments"},
+	{Name: PermissionOrdersRefund, Description: "Refund orders"},
+}
+
+// WarehousePermissions is what the warehouse role starts with
+var WarehousePermissions = []string{
+	PermissionInventoryWrite,
+	PermissionOrdersRead,
+	PermissionOrdersManage,
+}
+
+// IsKnownPermission reports whether name is in the permission catalog
+func IsKnownPermission(name string) bool {
+	for _, permission := range PermissionCatalog {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
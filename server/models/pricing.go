@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SaleActiveAt reports whether the variant's sale price applies at t
+func (v Variant) SaleActiveAt(t time.Time) bool {
+	if v.SalePrice == nil {
+		return false
+	}
+	if v.SaleStartsAt != nil && t.Before(*v.SaleStartsAt) {
+		return false
+	}
+	if v.SaleEndsAt != nil && !t.Before(*v.SaleEndsAt) {
+		return false
+	}
+	return true
+}
+
+// PriceAt returns the price the variant sells for at t
+func (v Variant) PriceAt(t time.Time) Money {
+	if v.SaleActiveAt(t) {
+		return *v.SalePrice
+	}
+	return v.Price
+}
+
+// ActiveAt reports whether the promotion runs at t
+func (p Promotion) ActiveAt(t time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil && t.Before(*p.StartsAt) {
+		return false
+	}
+	if p.EndsAt != nil && !t.Before(*p.EndsAt) {
+		return false
+	}
+	return true
+}
+
+// AfterFind fills the computed price fields so every response carries the price to charge
+func (v *Variant) AfterFind(tx *gorm.DB) error {
+	now := time.Now()
+	v.CurrentPrice = v.PriceAt(now)
+	v.OnSale = v.SaleActiveAt(now)
+	return nil
+}
@@ -0,0 +1,13 @@
+package models
+
+type PromotionType string
+
+const (
+	PromotionTypeBuyXGetY PromotionType = "buy_x_get_y"
+	PromotionTypeBundle   PromotionType = "bundle"
+)
+
+// IsValid reports whether the type is one of the known promotion types
+func (t PromotionType) IsValid() bool {
+	return t == PromotionTypeBuyXGetY || t == PromotionTypeBundle
+}
@@ -0,0 +1,8 @@
+package models
+
+type ReminderStatus string
+
+const (
+	ReminderStatusSent   ReminderStatus = "Sent"
+	ReminderStatusFailed ReminderStatus = "Failed"
+)
@@ -0,0 +1,21 @@
+package models
+
+type ShipmentStatus string
+
+const (
+	ShipmentStatusLabelCreated   ShipmentStatus = "LabelCreated"
+	ShipmentStatusInTransit      ShipmentStatus = "InTransit"
+	ShipmentStatusOutForDelivery ShipmentStatus = "OutForDelivery"
+	ShipmentStatusDelivered      ShipmentStatus = "Delivered"
+	ShipmentStatusException      ShipmentStatus = "Exception"
+)
+
+// IsValid reports whether the status is one of the known tracking statuses
+func (s ShipmentStatus) IsValid() bool {
+	switch s {
+	case ShipmentStatusLabelCreated, ShipmentStatusInTransit, ShipmentStatusOutForDelivery,
+		ShipmentStatusDelivered, ShipmentStatusException:
+		return true
+	}
+	return false
+}
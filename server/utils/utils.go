@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -74,6 +77,23 @@ func VerifyPassword(password string, hash string) bool {
 	return err == nil
 }
 
+// VerifySignature checks a hex encoded HMAC-SHA256 signature of payload made with secret
+func VerifySignature(payload []byte, signature string, secret string) bool {
+	// Without a secret anyone could sign, nothing is trusted
+	if secret == "" {
+		return false
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
+
 // ParseMultipartForm parses a multipart form and returns structured data
 func ParseMultipartForm(r *http.Request, maxMemory int64) (*MultiPartFormData, error) {
 	if err := r.ParseMultipartForm(maxMemory); err != nil {